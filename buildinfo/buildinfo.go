@@ -0,0 +1,75 @@
+// Package buildinfo reports the version of the mcp binaries.
+package buildinfo
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// Version, Commit and Date describe the build. Release builds set them
+// with -ldflags, e.g.
+//
+//	-X github.com/mcp-net/mcp-proxy/buildinfo.Version=v1.2.0
+//
+// Left empty, they are filled from the module version and VCS stamp that
+// the go command embeds in the binary.
+var (
+	Version string
+	Commit  string
+	Date    string
+)
+
+// Info is the version information of the running binary
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	Date      string `json:"date"`
+	GoVersion string `json:"goVersion"`
+}
+
+// Get returns the version information of the running binary. Fields that
+// can't be determined are "unknown", or "dev" for the version.
+func Get() Info {
+	info := Info{
+		Version:   Version,
+		Commit:    Commit,
+		Date:      Date,
+		GoVersion: runtime.Version(),
+	}
+
+	if build, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" && build.Main.Version != "" && build.Main.Version != "(devel)" {
+			info.Version = build.Main.Version
+		}
+		for _, setting := range build.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = setting.Value
+				}
+			case "vcs.time":
+				if info.Date == "" {
+					info.Date = setting.Value
+				}
+			}
+		}
+	}
+
+	if info.Version == "" {
+		info.Version = "dev"
+	}
+	if info.Commit == "" {
+		info.Commit = "unknown"
+	}
+	if info.Date == "" {
+		info.Date = "unknown"
+	}
+	return info
+}
+
+// Describe formats the information as printed by the -version flag of
+// the named binary
+func (i Info) Describe(name string) string {
+	return fmt.Sprintf("%s %s (commit %s, built %s, %s)", name, i.Version, i.Commit, i.Date, i.GoVersion)
+}
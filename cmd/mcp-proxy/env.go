@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// envPrefix is prepended to a flag's name to form the environment variable
+// it can also be set with, e.g. MCP_PROXY_ENDPOINT for -endpoint
+const envPrefix = "MCP_PROXY_"
+
+// envName returns the environment variable for the flag with the given name
+func envName(name string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// applyEnv sets every flag of flags that wasn't given on the command line
+// from its environment variable, if that is set, so flags take precedence.
+// A repeatable flag takes one value per line of its variable.
+func applyEnv(flags *flag.FlagSet) error {
+	set := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	var err error
+	flags.VisitAll(func(f *flag.Flag) {
+		if err != nil || set[f.Name] {
+			return
+		}
+		value, ok := os.LookupEnv(envName(f.Name))
+		if !ok {
+			return
+		}
+
+		values := []string{value}
+		if _, repeatable := f.Value.(*headerList); repeatable {
+			values = strings.Split(strings.TrimSpace(value), "\n")
+		}
+		for _, v := range values {
+			if setErr := f.Value.Set(v); setErr != nil {
+				err = fmt.Errorf("invalid value %q for %s: %w", v, envName(f.Name), setErr)
+				return
+			}
+		}
+	})
+	return err
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Framings of the messages exchanged with the client over stdin and stdout
+const (
+	// framingLine is newline-delimited JSON, one message per line
+	framingLine = "line"
+	// framingContentLength precedes each message with LSP-style
+	// Content-Length headers
+	framingContentLength = "content-length"
+)
+
+// readFramedMessage reads the next message framed by Content-Length headers
+// from reader. A message over maxSize bytes (0 for no limit) is skipped and
+// errMessageTooLarge is returned so the caller can carry on with the next
+// one.
+func readFramedMessage(reader *bufio.Reader, maxSize int) ([]byte, error) {
+	length := -1
+	sawHeader := false
+	for {
+		line, err := reader.ReadString('\n')
+		header := strings.TrimSpace(line)
+		if header == "" {
+			if err != nil {
+				if sawHeader && err == io.EOF {
+					err = io.ErrUnexpectedEOF
+				}
+				return nil, err
+			}
+			// Blank lines before the headers separate messages
+			if !sawHeader {
+				continue
+			}
+			break
+		}
+		sawHeader = true
+
+		name, value, ok := strings.Cut(header, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid header %q", header)
+		}
+		if strings.EqualFold(strings.TrimSpace(name), "Content-Length") {
+			n, convErr := strconv.Atoi(strings.TrimSpace(value))
+			if convErr != nil || n < 0 {
+				return nil, fmt.Errorf("invalid Content-Length header %q", header)
+			}
+			length = n
+		}
+		if err != nil {
+			return nil, io.ErrUnexpectedEOF
+		}
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("message has no Content-Length header")
+	}
+
+	if maxSize > 0 && length > maxSize {
+		if _, err := io.CopyN(io.Discard, reader, int64(length)); err != nil {
+			return nil, err
+		}
+		return nil, errMessageTooLarge
+	}
+
+	message := make([]byte, length)
+	if _, err := io.ReadFull(reader, message); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSpace(message), nil
+}
+
+// frameMessage returns message preceded by Content-Length headers
+func frameMessage(message []byte) []byte {
+	header := fmt.Sprintf("Content-Length: %d\r\n\r\n", len(message))
+	return append([]byte(header), message...)
+}
+
+// messageWriter writes messages to the client as complete frames, each on a
+// line of its own or preceded by Content-Length headers, so a client never
+// sees part of a message or two run together
+type messageWriter struct {
+	mu      sync.Mutex // serializes messages
+	out     *bufio.Writer
+	framing string
+	// flush is set if every message is flushed as soon as it is written,
+	// rather than once the buffer fills
+	flush bool
+}
+
+// newMessageWriter returns a writer of messages to out in framing
+func newMessageWriter(out io.Writer, framing string, flush bool) *messageWriter {
+	return &messageWriter{out: bufio.NewWriter(out), framing: framing, flush: flush}
+}
+
+// WriteMessage writes message as one frame, replacing any trailing line
+// break it already has
+func (w *messageWriter) WriteMessage(message []byte) error {
+	message = bytes.TrimRight(message, " \t\r\n")
+	if w.framing == framingContentLength {
+		message = frameMessage(message)
+	} else {
+		message = append(message, '\n')
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, err := w.out.Write(message); err != nil {
+		return err
+	}
+	if w.flush {
+		return w.out.Flush()
+	}
+	return nil
+}
+
+// Flush writes any buffered messages to the underlying writer
+func (w *messageWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.out.Flush()
+}
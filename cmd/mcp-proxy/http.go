@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// endpointCooldown is how long an endpoint that failed is skipped before
+// it is tried again
+const endpointCooldown = 30 * time.Second
+
+// HTTPTransport forwards MCP (Model Context Protocol) messages to an HTTP
+// endpoint, one POST per message, relaying the response to each. Given
+// several endpoints, such as replicas of one server, it fails over to the
+// next when one can't be reached or answers with a 5xx status.
+type HTTPTransport struct {
+	endpoints   []*httpEndpoint
+	roundRobin  bool // spread requests across the endpoints
+	next        int  // endpoint the next request starts at, if roundRobin
+	contentType string
+	headers     http.Header // custom headers added to every request
+	compress    bool        // gzip request bodies
+	httpClient  *http.Client
+	mu          sync.Mutex // serializes requests
+}
+
+// httpEndpoint is one endpoint of an HTTPTransport
+type httpEndpoint struct {
+	url string
+	// downUntil is when the endpoint is tried again after failing, or zero
+	// while it is healthy
+	downUntil time.Time
+}
+
+// TransportConfig tunes the connections of an HTTPTransport
+type TransportConfig struct {
+	// MaxIdleConns is the maximum number of idle keep-alive connections
+	// kept to the endpoint
+	MaxIdleConns int
+	// IdleConnTimeout is how long an idle connection is kept before it is
+	// closed (0 for no limit)
+	IdleConnTimeout time.Duration
+	// DialTimeout limits connecting to the endpoint, including the TLS
+	// handshake (0 for no limit)
+	DialTimeout time.Duration
+	// ResponseHeaderTimeout limits the wait for the response headers once
+	// the request is sent, without limiting how long the body takes to
+	// stream (0 for no limit)
+	ResponseHeaderTimeout time.Duration
+	// HTTP2 enables HTTP/2 for https endpoints that support it
+	HTTP2 bool
+	// Compress gzips request bodies and asks for gzipped responses
+	Compress bool
+	// RoundRobin spreads requests across the endpoints rather than sending
+	// them all to the first healthy one
+	RoundRobin bool
+}
+
+// NewHTTPTransport creates a transport to the specified endpoints, tried in
+// order, that sends the given content type and custom headers. Each
+// request, including reading the response body, must complete within
+// timeoutSeconds (0 for no limit).
+func NewHTTPTransport(httpEndpoints []string, contentType string, headers http.Header, transport TransportConfig, timeoutSeconds int) *HTTPTransport {
+	dialer := &net.Dialer{
+		Timeout:   transport.DialTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+	httpTransport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     transport.HTTP2,
+		MaxIdleConns:          transport.MaxIdleConns,
+		MaxIdleConnsPerHost:   transport.MaxIdleConns,
+		IdleConnTimeout:       transport.IdleConnTimeout,
+		TLSHandshakeTimeout:   transport.DialTimeout,
+		ResponseHeaderTimeout: transport.ResponseHeaderTimeout,
+		ExpectContinueTimeout: time.Second,
+		// Gzipped responses are requested, and decoded, only if enabled
+		DisableCompression: !transport.Compress,
+	}
+	if !transport.HTTP2 {
+		// A non-nil empty map keeps the transport from upgrading to HTTP/2
+		httpTransport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+
+	endpoints := make([]*httpEndpoint, len(httpEndpoints))
+	for i, url := range httpEndpoints {
+		endpoints[i] = &httpEndpoint{url: url}
+	}
+
+	return &HTTPTransport{
+		endpoints:   endpoints,
+		roundRobin:  transport.RoundRobin,
+		contentType: contentType,
+		headers:     headers,
+		compress:    transport.Compress,
+		httpClient: &http.Client{
+			Transport: httpTransport,
+			Timeout:   time.Duration(timeoutSeconds) * time.Second,
+		},
+	}
+}
+
+// Send implements Transport. It posts request to the first healthy HTTP
+// endpoint, failing over to the others in turn, and returns the response,
+// which is nil when there is nothing to send back to the client. Endpoints
+// that failed recently are only tried once the rest have failed too.
+func (p *HTTPTransport) Send(ctx context.Context, request []byte) (response []byte, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ctx, span := tracer.Start(ctx, "forward", trace.WithSpanKind(trace.SpanKindClient))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	payload := request
+	if p.compress {
+		if payload, err = gzipBody(request); err != nil {
+			return nil, fmt.Errorf("failed to compress request: %w", err)
+		}
+	}
+
+	for _, endpoint := range p.attemptOrder() {
+		span.SetAttributes(attribute.String("http.url", endpoint.url))
+		var failover bool
+		response, failover, err = p.post(ctx, endpoint.url, request, payload)
+		if !failover {
+			// The endpoint answered, even if with an error of the request's
+			endpoint.downUntil = time.Time{}
+			return response, err
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+
+		endpoint.downUntil = time.Now().Add(endpointCooldown)
+		if len(p.endpoints) > 1 {
+			fmt.Fprintf(os.Stderr, "Endpoint %s failed, trying the next one: %v\n", endpoint.url, err)
+		}
+	}
+	return nil, err
+}
+
+// attemptOrder returns the endpoints in the order to try them for the next
+// request: healthy ones first, starting at the next in turn when requests
+// are spread across them, then those that failed recently
+func (p *HTTPTransport) attemptOrder() []*httpEndpoint {
+	start := 0
+	if p.roundRobin {
+		start = p.next
+		p.next = (p.next + 1) % len(p.endpoints)
+	}
+
+	now := time.Now()
+	order := make([]*httpEndpoint, 0, len(p.endpoints))
+	var down []*httpEndpoint
+	for i := range p.endpoints {
+		endpoint := p.endpoints[(start+i)%len(p.endpoints)]
+		if now.Before(endpoint.downUntil) {
+			down = append(down, endpoint)
+			continue
+		}
+		order = append(order, endpoint)
+	}
+	return append(order, down...)
+}
+
+// post sends payload, the possibly compressed request, to url and returns
+// the response. failover is set if the endpoint couldn't be reached or
+// failed with a 5xx status, so another endpoint may be tried.
+func (p *HTTPTransport) post(ctx context.Context, url string, request, payload []byte) (response []byte, failover bool, err error) {
+	// Create HTTP request
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+
+	// Set headers
+	for key, values := range p.headers {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", p.contentType)
+	if p.compress {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	// Send the request
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, true, fmt.Errorf("failed to send HTTP request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Check status code. Servers acknowledge notifications with 202 or 204
+	// and no body.
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusAccepted, http.StatusNoContent:
+		response, err = emptyResponse(request)
+		return response, false, err
+	default:
+		return nil, resp.StatusCode >= 500, fmt.Errorf("received non-OK response: %d", resp.StatusCode)
+	}
+
+	// Read the response body
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	// Some upstreams acknowledge with an empty body
+	if len(bytes.TrimSpace(body)) == 0 {
+		response, err = emptyResponse(request)
+		return response, false, err
+	}
+
+	return body, false, nil
+}
+
+// Close implements Transport. It closes the idle connections to the HTTP
+// endpoint.
+func (p *HTTPTransport) Close() error {
+	p.httpClient.CloseIdleConnections()
+	return nil
+}
+
+// gzipBody compresses a request body
+func gzipBody(body []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write(body); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// emptyResponse handles an empty successful upstream response. Notifications
+// expect no reply, so nil is returned for them; requests with an id get a
+// valid empty JSON-RPC result so the client isn't left waiting.
+func emptyResponse(request []byte) ([]byte, error) {
+	var message struct {
+		ID json.RawMessage `json:"id"`
+	}
+	if err := json.Unmarshal(request, &message); err != nil {
+		return nil, fmt.Errorf("received empty response to unparseable request: %w", err)
+	}
+
+	id := bytes.TrimSpace(message.ID)
+	if len(id) == 0 || bytes.Equal(id, []byte("null")) {
+		return nil, nil
+	}
+
+	response := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      json.RawMessage(id),
+		"result":  map[string]interface{}{},
+	}
+	return json.Marshal(response)
+}
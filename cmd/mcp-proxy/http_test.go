@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+
+	"github.com/mcp-net/mcp-proxy/server"
+)
+
+func TestEmptyResponse(t *testing.T) {
+	tests := []struct {
+		name    string
+		request string
+		// wantID is the id the synthesized result must echo, or empty if
+		// no reply is expected
+		wantID  string
+		wantErr bool
+	}{
+		{name: "request with a number id", request: `{"jsonrpc":"2.0","id":7,"method":"ping"}`, wantID: `7`},
+		{name: "request with a string id", request: `{"jsonrpc":"2.0","id":"abc","method":"ping"}`, wantID: `"abc"`},
+		{name: "notification", request: `{"jsonrpc":"2.0","method":"notifications/initialized"}`},
+		{name: "null id", request: `{"jsonrpc":"2.0","id":null,"method":"ping"}`},
+		{name: "unparseable request", request: `{"jsonrpc":`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := emptyResponse([]byte(tt.request))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("emptyResponse(%s) = %s, want an error", tt.request, response)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("emptyResponse(%s): %v", tt.request, err)
+			}
+
+			if tt.wantID == "" {
+				if response != nil {
+					t.Fatalf("emptyResponse(%s) = %s, want nil", tt.request, response)
+				}
+				return
+			}
+
+			var message struct {
+				JSONRPC string                     `json:"jsonrpc"`
+				ID      json.RawMessage            `json:"id"`
+				Result  map[string]json.RawMessage `json:"result"`
+			}
+			if err := json.Unmarshal(response, &message); err != nil {
+				t.Fatalf("emptyResponse(%s) = %s, not JSON: %v", tt.request, response, err)
+			}
+			if message.JSONRPC != "2.0" || string(message.ID) != tt.wantID || message.Result == nil || len(message.Result) != 0 {
+				t.Fatalf("emptyResponse(%s) = %s, want an empty result with id %s", tt.request, response, tt.wantID)
+			}
+		})
+	}
+}
+
+func TestNotificationThroughServer(t *testing.T) {
+	s, err := server.NewMCPServer(t.TempDir(), "test", "1.0")
+	if err != nil {
+		t.Fatalf("NewMCPServer: %v", err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.ServeHTTPListener(ln)
+	defer s.Shutdown(context.Background())
+
+	transport := NewHTTPTransport([]string{"http://" + ln.Addr().String() + "/"}, "application/json", nil, TransportConfig{}, 5)
+	defer transport.Close()
+
+	response, err := transport.Send(context.Background(), []byte(`{"jsonrpc":"2.0","method":"notifications/initialized"}`))
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if response != nil {
+		t.Fatalf("Send = %s, want no response to a notification", response)
+	}
+}
@@ -1,88 +1,177 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"os/signal"
-	"sync"
+	"strings"
 	"syscall"
 	"time"
+	"unicode"
+
+	"github.com/mcp-net/mcp-proxy/buildinfo"
+	"github.com/mcp-net/mcp-proxy/telemetry"
+	"go.opentelemetry.io/otel"
 )
 
-// MCPProxy handles forwarding MCP (Model Context Protocol) requests to an HTTP endpoint
-type MCPProxy struct {
-	httpEndpoint string
-	contentType  string
-	httpClient   *http.Client
-	mu           sync.Mutex // protects concurrent access to the proxy
+// tracer creates the proxy's spans, which are only recorded when
+// -otel-endpoint is set
+var tracer = otel.Tracer("github.com/mcp-net/mcp-proxy/cmd/mcp-proxy")
+
+// headerList is a flag.Value collecting repeated "Key: Value" headers
+type headerList []string
+
+// String implements flag.Value
+func (h *headerList) String() string {
+	return strings.Join(*h, ", ")
 }
 
-// NewMCPProxy creates a new MCP proxy with the specified endpoint and content type
-func NewMCPProxy(httpEndpoint, contentType string, timeoutSeconds int) *MCPProxy {
-	return &MCPProxy{
-		httpEndpoint: httpEndpoint,
-		contentType:  contentType,
-		httpClient: &http.Client{
-			Timeout: time.Duration(timeoutSeconds) * time.Second,
-		},
-	}
+// Set implements flag.Value
+func (h *headerList) Set(value string) error {
+	*h = append(*h, value)
+	return nil
 }
 
-// ProcessRequest forwards a request to the HTTP endpoint and returns the response
-func (p *MCPProxy) ProcessRequest(ctx context.Context, request []byte) ([]byte, error) {
-	p.mu.Lock()
-	defer p.mu.Unlock()
+// parseHeaders parses "Key: Value" entries into a header set, rejecting
+// entries that aren't valid HTTP header fields
+func parseHeaders(entries []string) (http.Header, error) {
+	headers := make(http.Header)
+	for _, entry := range entries {
+		key, value, ok := strings.Cut(entry, ":")
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+		if !ok || !validHeaderName(key) {
+			return nil, fmt.Errorf("invalid header %q, expected \"Key: Value\"", entry)
+		}
+		if strings.ContainsAny(value, "\r\n\x00") {
+			return nil, fmt.Errorf("invalid value for header %s", key)
+		}
+		headers.Add(key, value)
+	}
+	return headers, nil
+}
 
-	// Create HTTP request
-	req, err := http.NewRequestWithContext(ctx, "POST", p.httpEndpoint, bytes.NewReader(request))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+// validHeaderName reports whether name is a valid HTTP header field name,
+// which must be a non-empty token
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if r > unicode.MaxASCII || r <= ' ' || strings.ContainsRune("\"(),/:;<=>?@[\\]{}", r) {
+			return false
+		}
 	}
+	return true
+}
 
-	// Set headers
-	req.Header.Set("Content-Type", p.contentType)
+// errMessageTooLarge is returned for stdin messages over the size limit
+var errMessageTooLarge = errors.New("message exceeds maximum size")
 
-	// Send the request
-	resp, err := p.httpClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to send HTTP request: %w", err)
-	}
-	defer resp.Body.Close()
+// readMessage reads the next newline-delimited message from reader, without
+// the trailing newline. The buffer grows as needed up to maxSize bytes
+// (0 for no limit); a longer message is discarded and errMessageTooLarge is
+// returned so the caller can carry on with the next one.
+func readMessage(reader *bufio.Reader, maxSize int) ([]byte, error) {
+	var message []byte
+	tooLarge := false
 
-	// Check status code
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("received non-OK response: %d", resp.StatusCode)
-	}
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if !tooLarge {
+			if maxSize > 0 && len(message)+len(chunk) > maxSize+1 {
+				tooLarge = true
+				message = nil
+			} else {
+				message = append(message, chunk...)
+			}
+		}
 
-	// Read the response body
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
-	}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if tooLarge {
+			if err != nil && err != io.EOF {
+				return nil, err
+			}
+			return nil, errMessageTooLarge
+		}
+		if err != nil && (err != io.EOF || len(message) == 0) {
+			return nil, err
+		}
 
-	return body, nil
+		return bytes.TrimRight(message, "\r\n"), nil
+	}
 }
 
 func main() {
 	// Define command line flags
-	endpoint := flag.String("endpoint", "http://localhost:8080", "HTTP endpoint to proxy requests to")
+	endpoint := flag.String("endpoint", "http://localhost:8080", "Endpoint to proxy requests to: http(s):// URLs, comma-separated to fail over between replicas, or a ws(s):// URL to tunnel messages over a WebSocket to a third-party MCP server")
+	wsURL := flag.String("ws", "", "WebSocket URL (ws:// or wss://) of a third-party MCP server to tunnel messages to, overriding -endpoint; mcp-server has no WebSocket endpoint")
 	contentType := flag.String("content-type", "application/json", "Content-Type header for HTTP requests")
-	timeout := flag.Int("timeout", 30, "HTTP request timeout in seconds")
-	bufferSize := flag.Int("buffer", 64, "Buffer size in KB for reading from stdin")
+	timeout := flag.Int("timeout", 30, "Total HTTP request timeout in seconds, including reading the response (0 for no limit)")
+	dialTimeout := flag.Duration("dial-timeout", 10*time.Second, "Timeout for connecting to the endpoint, including the TLS handshake (0 for no limit)")
+	responseHeaderTimeout := flag.Duration("response-header-timeout", 0, "Timeout for receiving the response headers once a request is sent (0 for no limit)")
+	maxIdleConns := flag.Int("max-idle-conns", 100, "Maximum number of idle keep-alive connections to the endpoint")
+	idleTimeout := flag.Duration("idle-timeout", 90*time.Second, "Time an idle keep-alive connection is kept open (0 for no limit)")
+	http2 := flag.Bool("http2", true, "Use HTTP/2 with https endpoints that support it")
+	roundRobin := flag.Bool("round-robin", false, "Spread requests across the endpoints in turn instead of preferring the first healthy one")
+	compress := flag.Bool("compress", false, "Gzip request bodies and accept gzipped responses")
+	readTimeout := flag.Duration("read-timeout", 0, "Maximum time a message on stdin may take to arrive once started (0 for no limit)")
+	waitFor := flag.Duration("wait-for-endpoint", 0, "Wait up to this long at startup for the endpoint to accept connections, retrying with backoff (0 to not wait)")
+	drainTimeout := flag.Duration("drain-timeout", 30*time.Second, "With a WebSocket endpoint, how long to wait at the end of stdin for replies to requests already sent (0 for no limit)")
+	bufferSize := flag.Int("buffer", 64, "Initial buffer size in KB for reading from stdin")
+	var headerEntries headerList
+	flag.Var(&headerEntries, "header", "Custom header to send with every request, as \"Key: Value\" (repeatable)")
+	otelEndpoint := flag.String("otel-endpoint", "", "OTLP/HTTP endpoint to export trace spans to (e.g. http://localhost:4318); tracing is off if empty")
+	maxMessageSize := flag.Int("max-message-size", 16384, "Maximum size in KB of a message read from stdin (0 for no limit)")
+	framing := flag.String("framing", framingLine, "Framing of messages on stdin and stdout: line or content-length")
+	flush := flag.Bool("flush", true, "Flush stdout after every message; disable to buffer output written to a file or pipe")
+	printVersion := flag.Bool("version", false, "Print the version, commit and build date of mcp-proxy and exit")
 	flag.Parse()
 
-	// Create a new proxy
-	proxy := NewMCPProxy(*endpoint, *contentType, *timeout)
+	if *printVersion {
+		fmt.Println(buildinfo.Get().Describe("mcp-proxy"))
+		return
+	}
+
+	// Flags not given on the command line fall back to MCP_PROXY_* variables
+	if err := applyEnv(flag.CommandLine); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	headers, err := parseHeaders(headerEntries)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if *framing != framingLine && *framing != framingContentLength {
+		fmt.Fprintf(os.Stderr, "Error: invalid framing %q, expected %s or %s\n", *framing, framingLine, framingContentLength)
+		os.Exit(1)
+	}
 
 	// Set up a context that can be cancelled
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// Export trace spans if requested
+	if *otelEndpoint != "" {
+		shutdownTracing, err := telemetry.Setup(ctx, *otelEndpoint, "mcp-proxy")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		defer shutdownTracing(context.Background())
+	}
+
 	// Handle OS signals for graceful shutdown
 	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
@@ -92,47 +181,200 @@ func main() {
 		cancel()
 	}()
 
-	fmt.Fprintf(os.Stderr, "MCP Proxy started. Forwarding requests to %s\n", *endpoint)
+	// The scheme of the targets selects the transport
+	targets := splitEndpoints(*endpoint)
+	if *wsURL != "" {
+		targets = []string{*wsURL}
+	}
+	target := strings.Join(targets, ", ")
+
+	// Under a supervisor the server may still be starting, so optionally
+	// hold off reading stdin until it accepts connections
+	if *waitFor > 0 {
+		if err := waitForEndpoint(ctx, targets, *waitFor); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
 
-	// Process stdin/stdout in the main goroutine
+	// Relay messages between stdin/stdout and the endpoint
 	stdin := os.Stdin
-	stdout := os.Stdout
+	stdout := newMessageWriter(os.Stdout, *framing, *flush)
+	defer stdout.Flush()
+
+	transport, err := newTransport(ctx, targets, transportOptions{
+		contentType: *contentType,
+		headers:     headers,
+		http: TransportConfig{
+			MaxIdleConns:          *maxIdleConns,
+			IdleConnTimeout:       *idleTimeout,
+			DialTimeout:           *dialTimeout,
+			ResponseHeaderTimeout: *responseHeaderTimeout,
+			HTTP2:                 *http2,
+			Compress:              *compress,
+			RoundRobin:            *roundRobin,
+		},
+		timeoutSeconds: *timeout,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer transport.Close()
+
+	streaming, isStreaming := transport.(StreamingTransport)
+	pumpDone := make(chan struct{})
+	if isStreaming {
+		// Relay server messages as they arrive. Once the connection is gone
+		// there is nothing left to do, so stop reading stdin too.
+		go func() {
+			defer close(pumpDone)
+			if err := streaming.Pump(stdout); err != nil {
+				fmt.Fprintf(os.Stderr, "Error receiving from %s: %v\n", target, err)
+			}
+			cancel()
+		}()
+		fmt.Fprintf(os.Stderr, "MCP Proxy started. Tunneling messages to %s\n", target)
+	} else {
+		fmt.Fprintf(os.Stderr, "MCP Proxy started. Forwarding requests to %s\n", target)
+	}
+
+	// Read newline-delimited messages, growing past the initial buffer size
+	// as needed, optionally bounding how long each may take to arrive
+	var input io.Reader = stdin
+	var timeoutInput *timeoutReader
+	if *readTimeout > 0 {
+		timeoutInput = newTimeoutReader(stdin, *readTimeout)
+		input = timeoutInput
+	}
+	reader := bufio.NewReaderSize(input, *bufferSize*1024)
 
-	// Create a buffer for reading from stdin
-	buffer := make([]byte, *bufferSize*1024)
+	// Read stdin in the background, since a blocking read can't be
+	// interrupted, so the loop below stops as soon as ctx is done
+	messages := make(chan stdinMessage)
+	go func() {
+		defer close(messages)
+		for {
+			var message stdinMessage
+			if timeoutInput != nil {
+				timeoutInput.beginMessage()
+			}
+			if *framing == framingContentLength {
+				message.data, message.err = readFramedMessage(reader, *maxMessageSize*1024)
+			} else {
+				message.data, message.err = readMessage(reader, *maxMessageSize*1024)
+			}
+
+			select {
+			case messages <- message:
+			case <-ctx.Done():
+				return
+			}
+			if message.err != nil && message.err != errMessageTooLarge && message.err != errReadTimeout {
+				return
+			}
+		}
+	}()
+
+	// discardNext is set when a line was abandoned part way, so its
+	// remainder isn't mistaken for a message of its own
+	discardNext := false
 
 	for {
+		var next stdinMessage
 		select {
 		case <-ctx.Done():
 			fmt.Fprintf(os.Stderr, "MCP Proxy shutting down\n")
 			return
-		default:
-			// Read from stdin
-			n, err := stdin.Read(buffer)
-			if err != nil {
-				if err != io.EOF {
-					fmt.Fprintf(os.Stderr, "Error reading from stdin: %v\n", err)
-				}
+		case next = <-messages:
+		}
+
+		message, err := next.data, next.err
+		if err == errMessageTooLarge {
+			fmt.Fprintf(os.Stderr, "Error reading from stdin: %v (limit %d KB)\n", err, *maxMessageSize)
+			continue
+		}
+		if err == errReadTimeout {
+			// The rest of an abandoned line can be skipped, but a framed
+			// message can't be told apart from the headers of the next
+			fmt.Fprintf(os.Stderr, "Error reading from stdin: %v (%v), discarding it\n", err, *readTimeout)
+			if *framing == framingContentLength {
 				cancel()
 				return
 			}
+			discardNext = true
+			continue
+		}
+		if discardNext && err == nil {
+			discardNext = false
+			continue
+		}
+		if err == io.EOF && isStreaming {
+			// Replies to the requests already sent are still on their
+			// way, so close the stream gracefully rather than dropping it
+			drainStream(ctx, streaming, pumpDone, *drainTimeout)
+			return
+		}
+		if err != nil {
+			if err != io.EOF && ctx.Err() == nil {
+				fmt.Fprintf(os.Stderr, "Error reading from stdin: %v\n", err)
+			}
+			cancel()
+			return
+		}
 
-			if n > 0 {
-				// Process the request
-				response, err := proxy.ProcessRequest(ctx, buffer[:n])
-				if err != nil {
-					fmt.Fprintf(os.Stderr, "Error processing request: %v\n", err)
-					continue
-				}
-
-				// Write the response to stdout
-				_, err = stdout.Write(response)
-				if err != nil {
-					fmt.Fprintf(os.Stderr, "Error writing to stdout: %v\n", err)
+		if len(bytes.TrimSpace(message)) > 0 {
+			// Forward the message
+			response, err := transport.Send(ctx, message)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error forwarding message: %v\n", err)
+				// A failed stream is not recovered, unlike a failed request
+				if isStreaming {
 					cancel()
 					return
 				}
+				continue
+			}
+
+			// Notifications, and messages whose responses arrive through
+			// Pump, have no response to write here
+			if response == nil {
+				continue
+			}
+
+			// Write the response to stdout
+			if err := stdout.WriteMessage(response); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing to stdout: %v\n", err)
+				cancel()
+				return
 			}
 		}
 	}
 }
+
+// stdinMessage is a message read from stdin, or the error reading it
+type stdinMessage struct {
+	data []byte
+	err  error
+}
+
+// drainStream closes a streaming transport once stdin is exhausted: it
+// waits for replies to the requests already sent, up to timeout (0 for no
+// limit), sends a close frame and keeps relaying until the server closes
+// the connection or the timeout expires
+func drainStream(ctx context.Context, streaming StreamingTransport, pumpDone <-chan struct{}, timeout time.Duration) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	if err := streaming.CloseSend(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+
+	select {
+	case <-pumpDone:
+	case <-ctx.Done():
+	}
+}
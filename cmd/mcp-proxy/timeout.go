@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+// errReadTimeout is returned when a message started on stdin isn't
+// completed within the read timeout
+var errReadTimeout = errors.New("message not completed within the read timeout")
+
+// timeoutReader bounds how long a message may take to arrive once its first
+// bytes have been read, so a client trickling bytes can't hold the read loop
+// forever. Waiting for a message to start is not limited. The underlying
+// reader is read by a goroutine of its own, since a blocking read of stdin
+// can't be interrupted.
+type timeoutReader struct {
+	chunks  <-chan readChunk
+	pending []byte
+	err     error
+
+	timeout time.Duration
+	// deadline is when the message in progress must be complete, or zero
+	// while waiting for a message to start
+	deadline time.Time
+}
+
+// readChunk is the outcome of one read of the underlying reader
+type readChunk struct {
+	data []byte
+	err  error
+}
+
+// newTimeoutReader reads r in the background, allowing each message
+// timeout to arrive once it has started
+func newTimeoutReader(r io.Reader, timeout time.Duration) *timeoutReader {
+	chunks := make(chan readChunk)
+	go func() {
+		for {
+			buf := make([]byte, 32*1024)
+			n, err := r.Read(buf)
+			chunks <- readChunk{data: buf[:n], err: err}
+			if err != nil {
+				close(chunks)
+				return
+			}
+		}
+	}()
+	return &timeoutReader{chunks: chunks, timeout: timeout}
+}
+
+// beginMessage marks the start of the next message, so its deadline is set
+// once its first bytes arrive
+func (t *timeoutReader) beginMessage() {
+	t.deadline = time.Time{}
+}
+
+// Read implements io.Reader. It returns errReadTimeout once the deadline of
+// the message in progress has passed; reading may carry on afterwards.
+func (t *timeoutReader) Read(p []byte) (int, error) {
+	if len(t.pending) == 0 && t.err == nil {
+		var chunk readChunk
+		var ok bool
+		if t.deadline.IsZero() {
+			chunk, ok = <-t.chunks
+			t.deadline = time.Now().Add(t.timeout)
+		} else {
+			timer := time.NewTimer(time.Until(t.deadline))
+			select {
+			case chunk, ok = <-t.chunks:
+				timer.Stop()
+			case <-timer.C:
+				return 0, errReadTimeout
+			}
+		}
+		if !ok {
+			chunk.err = io.EOF
+		}
+		t.pending, t.err = chunk.data, chunk.err
+	}
+
+	if len(t.pending) > 0 {
+		n := copy(p, t.pending)
+		t.pending = t.pending[n:]
+		return n, nil
+	}
+	return 0, t.err
+}
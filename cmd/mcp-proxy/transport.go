@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Transport carries MCP messages read from stdin to a server
+type Transport interface {
+	// Send forwards a message to the server and returns the response to
+	// write to stdout, or nil if there is none to write now
+	Send(ctx context.Context, message []byte) ([]byte, error)
+	// Close releases the transport's connections
+	Close() error
+}
+
+// StreamingTransport is a Transport whose server may send messages at any
+// time, so they are relayed by Pump rather than returned by Send
+type StreamingTransport interface {
+	Transport
+	// Pump writes the messages received from the server to out until the
+	// connection fails or is closed
+	Pump(out *messageWriter) error
+	// CloseSend tells the server no more messages follow, once the
+	// requests sent have been answered or ctx is done. Pump keeps relaying
+	// until the server closes the connection.
+	CloseSend(ctx context.Context) error
+}
+
+// transportOptions holds the settings newTransport builds a transport with
+type transportOptions struct {
+	contentType    string
+	headers        http.Header
+	http           TransportConfig
+	timeoutSeconds int
+}
+
+// newTransport returns the transport for the scheme of endpoints: HTTP for
+// http and https, failing over between the endpoints, or a connected
+// WebSocket for a single ws or wss endpoint
+func newTransport(ctx context.Context, endpoints []string, options transportOptions) (Transport, error) {
+	if len(endpoints) == 0 {
+		return nil, errors.New("no endpoint given")
+	}
+
+	schemes := make(map[string]bool)
+	for _, endpoint := range endpoints {
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("invalid endpoint %q: %w", endpoint, err)
+		}
+		switch u.Scheme {
+		case "http", "https":
+			schemes["http"] = true
+		case "ws", "wss":
+			schemes["ws"] = true
+		default:
+			return nil, fmt.Errorf("invalid endpoint %q: unsupported scheme %q", endpoint, u.Scheme)
+		}
+	}
+
+	switch {
+	case schemes["http"] && schemes["ws"]:
+		return nil, fmt.Errorf("endpoints mix HTTP and WebSocket URLs")
+	case schemes["http"]:
+		return NewHTTPTransport(endpoints, options.contentType, options.headers, options.http, options.timeoutSeconds), nil
+	case len(endpoints) > 1:
+		return nil, fmt.Errorf("a WebSocket transport takes a single endpoint, got %d", len(endpoints))
+	default:
+		transport := NewWSTransport(endpoints[0], options.headers, options.timeoutSeconds)
+		if err := transport.Connect(ctx); err != nil {
+			return nil, err
+		}
+		return transport, nil
+	}
+}
+
+// splitEndpoints splits a comma-separated list of endpoints, ignoring
+// blank entries
+func splitEndpoints(list string) []string {
+	var endpoints []string
+	for _, endpoint := range strings.Split(list, ",") {
+		if endpoint = strings.TrimSpace(endpoint); endpoint != "" {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	return endpoints
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// waitInitialBackoff is the delay before the first retry of an
+	// unreachable endpoint, doubled after every further attempt
+	waitInitialBackoff = 100 * time.Millisecond
+	// waitMaxBackoff caps the delay between attempts
+	waitMaxBackoff = 5 * time.Second
+)
+
+// waitForEndpoint blocks until a TCP connection to the host of one of
+// endpoints, http, https, ws or wss URLs, can be opened, retrying with
+// exponential backoff for at most maxWait. It gives up early if ctx is
+// cancelled.
+func waitForEndpoint(ctx context.Context, endpoints []string, maxWait time.Duration) error {
+	addresses := make([]string, len(endpoints))
+	for i, endpoint := range endpoints {
+		address, err := endpointAddress(endpoint)
+		if err != nil {
+			return err
+		}
+		addresses[i] = address
+	}
+	list := strings.Join(addresses, ", ")
+
+	ctx, cancel := context.WithTimeout(ctx, maxWait)
+	defer cancel()
+
+	var dialer net.Dialer
+	backoff := waitInitialBackoff
+	for attempt := 1; ; attempt++ {
+		var err error
+		for _, address := range addresses {
+			var conn net.Conn
+			if conn, err = dialer.DialContext(ctx, "tcp", address); err == nil {
+				conn.Close()
+				if attempt > 1 {
+					fmt.Fprintf(os.Stderr, "Endpoint %s is reachable\n", address)
+				}
+				return nil
+			}
+		}
+		if attempt == 1 {
+			fmt.Fprintf(os.Stderr, "Waiting up to %v for endpoint %s: %v\n", maxWait, list, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("endpoint %s not reachable after %d attempts: %w", list, attempt, err)
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > waitMaxBackoff {
+			backoff = waitMaxBackoff
+		}
+	}
+}
+
+// endpointAddress returns the host:port to dial for endpoint, using the
+// default port of its scheme when it has none
+func endpointAddress(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid endpoint %q: %w", endpoint, err)
+	}
+	if u.Hostname() == "" {
+		return "", fmt.Errorf("invalid endpoint %q: missing host", endpoint)
+	}
+
+	port := u.Port()
+	if port == "" {
+		switch u.Scheme {
+		case "http", "ws":
+			port = "80"
+		case "https", "wss":
+			port = "443"
+		default:
+			return "", fmt.Errorf("invalid endpoint %q: unsupported scheme %q", endpoint, u.Scheme)
+		}
+	}
+	return net.JoinHostPort(u.Hostname(), port), nil
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// wsPingInterval is how often the proxy pings the server to keep an idle
+// connection from being dropped by intermediaries
+const wsPingInterval = 30 * time.Second
+
+// WSTransport tunnels MCP messages to a server over a long-lived WebSocket
+// connection. Unlike HTTPTransport, the server may send messages at any
+// time, not only in response to a request, so they are relayed by Pump.
+// It targets third-party MCP servers; mcp-server has no WebSocket endpoint.
+type WSTransport struct {
+	url     string
+	headers http.Header // custom headers sent with the opening handshake
+	dialer  *websocket.Dialer
+	conn    *websocket.Conn
+	mu      sync.Mutex // serializes writes to conn
+
+	// pending holds the ids of requests sent whose responses haven't
+	// arrived, and answered is signalled whenever one does
+	pending     map[string]bool
+	pendingMu   sync.Mutex
+	answered    chan struct{}
+	closingSend bool
+}
+
+// NewWSTransport creates a new WebSocket transport for the server at url,
+// whose opening handshake carries headers and must complete within
+// timeoutSeconds
+func NewWSTransport(url string, headers http.Header, timeoutSeconds int) *WSTransport {
+	return &WSTransport{
+		url:     url,
+		headers: headers,
+		dialer: &websocket.Dialer{
+			HandshakeTimeout: time.Duration(timeoutSeconds) * time.Second,
+		},
+		pending:  make(map[string]bool),
+		answered: make(chan struct{}, 1),
+	}
+}
+
+// Connect opens the WebSocket connection and starts keeping it alive
+func (p *WSTransport) Connect(ctx context.Context) error {
+	conn, _, err := p.dialer.DialContext(ctx, p.url, p.headers)
+	if err != nil {
+		return fmt.Errorf("failed to connect to WebSocket: %w", err)
+	}
+	p.conn = conn
+
+	go p.keepAlive(ctx)
+	return nil
+}
+
+// Send implements Transport. It forwards a message read from the client to
+// the server; any reply arrives through Pump, so none is returned.
+func (p *WSTransport) Send(ctx context.Context, message []byte) ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closingSend {
+		return nil, errors.New("WebSocket connection is closing")
+	}
+	if err := p.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+		return nil, fmt.Errorf("failed to send WebSocket message: %w", err)
+	}
+
+	p.pendingMu.Lock()
+	for _, id := range requestIDs(message) {
+		p.pending[id] = true
+	}
+	p.pendingMu.Unlock()
+	return nil, nil
+}
+
+// Pump implements StreamingTransport. It writes the messages received from
+// the server to out until the connection fails or is closed
+func (p *WSTransport) Pump(out *messageWriter) error {
+	for {
+		_, message, err := p.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+				return nil
+			}
+			return fmt.Errorf("failed to read WebSocket message: %w", err)
+		}
+
+		if err := out.WriteMessage(message); err != nil {
+			return fmt.Errorf("failed to write message: %w", err)
+		}
+		p.markAnswered(message)
+	}
+}
+
+// markAnswered forgets the requests that message, received from the server,
+// responds to
+func (p *WSTransport) markAnswered(message []byte) {
+	ids := responseIDs(message)
+	if len(ids) == 0 {
+		return
+	}
+
+	p.pendingMu.Lock()
+	for _, id := range ids {
+		delete(p.pending, id)
+	}
+	p.pendingMu.Unlock()
+
+	select {
+	case p.answered <- struct{}{}:
+	default:
+	}
+}
+
+// CloseSend implements StreamingTransport. It waits until every request
+// sent has been answered, or ctx is done, and then sends a close frame.
+// Messages from the server are still received until it closes the
+// connection.
+func (p *WSTransport) CloseSend(ctx context.Context) error {
+	unanswered := p.awaitAnswers(ctx)
+
+	p.mu.Lock()
+	p.closingSend = true
+	message := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	err := p.conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second))
+	p.mu.Unlock()
+
+	if err != nil {
+		return fmt.Errorf("failed to send WebSocket close frame: %w", err)
+	}
+	if unanswered > 0 {
+		return fmt.Errorf("closed with %d requests unanswered", unanswered)
+	}
+	return nil
+}
+
+// awaitAnswers waits until every request sent has been answered or ctx is
+// done, returning the number left unanswered
+func (p *WSTransport) awaitAnswers(ctx context.Context) int {
+	for {
+		p.pendingMu.Lock()
+		outstanding := len(p.pending)
+		p.pendingMu.Unlock()
+		if outstanding == 0 {
+			return 0
+		}
+
+		select {
+		case <-p.answered:
+		case <-ctx.Done():
+			return outstanding
+		}
+	}
+}
+
+// Close implements Transport. It closes the connection, telling the server
+// the client is done.
+func (p *WSTransport) Close() error {
+	p.mu.Lock()
+	if !p.closingSend {
+		message := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+		p.conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second))
+	}
+	p.mu.Unlock()
+
+	return p.conn.Close()
+}
+
+// keepAlive pings the server until ctx is done or a ping fails
+func (p *WSTransport) keepAlive(ctx context.Context) {
+	ticker := time.NewTicker(wsPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.mu.Lock()
+			err := p.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsPingInterval))
+			p.mu.Unlock()
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+// requestIDs returns the ids of the requests in message, a JSON-RPC message
+// or batch sent to the server; notifications and responses have none
+func requestIDs(message []byte) []string {
+	var ids []string
+	for _, element := range jsonRPCElements(message) {
+		if element.Method != "" && len(element.ID) > 0 && string(element.ID) != "null" {
+			ids = append(ids, string(element.ID))
+		}
+	}
+	return ids
+}
+
+// responseIDs returns the ids of the responses in message, a JSON-RPC
+// message or batch received from the server
+func responseIDs(message []byte) []string {
+	var ids []string
+	for _, element := range jsonRPCElements(message) {
+		if element.Method == "" && len(element.ID) > 0 {
+			ids = append(ids, string(element.ID))
+		}
+	}
+	return ids
+}
+
+// jsonRPCElement holds the members of a JSON-RPC message that tell requests
+// and responses apart
+type jsonRPCElement struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+}
+
+// jsonRPCElements parses message as a single JSON-RPC message or a batch,
+// returning nothing if it is neither
+func jsonRPCElements(message []byte) []jsonRPCElement {
+	var batch []jsonRPCElement
+	if json.Unmarshal(message, &batch) == nil {
+		return batch
+	}
+	var single jsonRPCElement
+	if json.Unmarshal(message, &single) == nil {
+		return []jsonRPCElement{single}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/mcp-net/mcp-proxy/server"
+)
+
+// printTools writes the tool catalog to w in format, "table" for a
+// human-readable table or "json" for the tools as clients list them
+func printTools(w io.Writer, tools []server.ToolInfo, format string) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(tools)
+	case "table":
+		table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(table, "TOOL\tPARAMETERS\tDESCRIPTION")
+		for _, tool := range tools {
+			fmt.Fprintf(table, "%s\t%s\t%s\n", tool.Name, paramSummary(tool.Parameters), firstLine(tool.Description))
+		}
+		return table.Flush()
+	default:
+		return fmt.Errorf("invalid format %q, expected table or json", format)
+	}
+}
+
+// paramSummary summarizes the properties of an input schema in name order,
+// as "name type", with optional ones marked "?", e.g. "x number, unit? string"
+func paramSummary(schema map[string]interface{}) string {
+	properties, _ := schema["properties"].(map[string]interface{})
+	if len(properties) == 0 {
+		return "-"
+	}
+
+	required := make(map[string]bool)
+	if names, ok := schema["required"].([]interface{}); ok {
+		for _, name := range names {
+			if name, ok := name.(string); ok {
+				required[name] = true
+			}
+		}
+	}
+
+	names := make([]string, 0, len(properties))
+	for name := range properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	params := make([]string, 0, len(names))
+	for _, name := range names {
+		param := name
+		if !required[name] {
+			param += "?"
+		}
+		if property, ok := properties[name].(map[string]interface{}); ok {
+			if typ, ok := property["type"].(string); ok {
+				param += " " + typ
+			}
+		}
+		params = append(params, param)
+	}
+	return strings.Join(params, ", ")
+}
+
+// firstLine returns the first line of a description, which is all that
+// fits in a table row
+func firstLine(description string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(description), "\n")
+	return line
+}
@@ -1,56 +1,350 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strings"
 	"syscall"
+	"time"
 
+	"github.com/mcp-net/mcp-proxy/buildinfo"
+	"github.com/mcp-net/mcp-proxy/config"
 	"github.com/mcp-net/mcp-proxy/server"
+	"github.com/mcp-net/mcp-proxy/telemetry"
 )
 
 func main() {
 	// Define command line flags
-	mcpDirectory := flag.String("mcp-dir", "./mcps", "Directory containing MCP executables")
+	configPath := flag.String("config", "", "Path to a YAML or JSON config file; flags override its settings")
+	var mcpDirectories stringList
+	flag.Var(&mcpDirectories, "mcp-dir", "Directory containing MCP executables (repeatable or comma-separated; default ./mcps)")
+	dirConflicts := flag.String("mcp-dir-conflict", server.DirConflictOverride, "How an MCP name found in more than one -mcp-dir is resolved: override (the last directory wins) or error")
+	mcpManifest := flag.String("mcp-manifest", "", "JSON file listing the MCPs to load instead of scanning -mcp-dir")
 	httpAddr := flag.String("http", ":8080", "HTTP server address")
+	transport := flag.String("transport", "http", "HTTP transport to serve: http or sse")
 	name := flag.String("name", "MCP Server", "Name of the MCP server")
-	version := flag.String("version", "1.0.0", "Version of the MCP server")
+	version := flag.String("version", buildinfo.Get().Version, "Version of the MCP server")
+	printVersion := flag.Bool("print-version", false, "Print the version, commit and build date of mcp-server and exit")
 	useStdio := flag.Bool("stdio", false, "Use stdio instead of HTTP")
+	readyRequireAll := flag.Bool("ready-require-all", false, "Report not ready on /readyz while any MCP has failed")
+	maxArgDepth := flag.Int("max-arg-depth", server.DefaultMaxArgumentDepth, "Maximum nesting depth of tool call arguments (0 for no limit)")
+	maxArgElements := flag.Int("max-arg-elements", server.DefaultMaxArgumentElements, "Maximum number of elements in tool call arguments (0 for no limit)")
+	healthInterval := flag.Duration("health-interval", 0, "Interval between MCP health checks (0 disables health checks)")
+	maskErrors := flag.Bool("mask-errors", false, "Hide error details from clients and log them under a reference id")
+	strict := flag.Bool("strict", false, "Reject HTTP requests whose jsonrpc member isn't \"2.0\" instead of logging a warning")
+	breakerThreshold := flag.Int("breaker-threshold", server.DefaultBreakerThreshold, "Consecutive MCP failures that open its circuit breaker (0 disables the breaker)")
+	breakerWindow := flag.Duration("breaker-window", server.DefaultBreakerWindow, "Window in which failures count towards opening a circuit breaker")
+	breakerCooldown := flag.Duration("breaker-cooldown", server.DefaultBreakerCooldown, "Time an open circuit breaker waits before trying the MCP again")
+	drainTimeout := flag.Duration("drain-timeout", 30*time.Second, "Maximum time to wait for in-flight requests when restarting or shutting down")
+	idleTimeout := flag.Duration("idle-timeout", server.DefaultIdleTimeout, "Shut down persistent MCP subprocesses after this long without calls (0 to keep them running)")
+	adminAddr := flag.String("admin-addr", "", "Address to serve the admin API on (e.g. 127.0.0.1:9090); disabled if empty")
+	adminToken := flag.String("admin-token", "", "Bearer token required by the admin API (default from $MCP_SERVER_ADMIN_TOKEN)")
+	grpcAddr := flag.String("grpc-addr", "", "Address to serve the tools over gRPC on (e.g. :9091); disabled if empty")
+	noCache := flag.Bool("no-cache", false, "Discover the tools of every MCP instead of using the tool cache")
+	failIfEmpty := flag.Bool("fail-if-empty", false, "Exit with an error if the MCP directory holds no MCPs")
+	discoveryTimeout := flag.Duration("discovery-timeout", server.DefaultDiscoveryTimeout, "Maximum time discovering the tools of an MCP may take, from starting it to its tool list (0 for no limit)")
+	execTimeout := flag.Duration("exec-timeout", 0, "Default maximum time a tool call may take, unless the tool sets timeoutSeconds (0 for no limit)")
+	protocolVersion := flag.String("protocol-version", server.DefaultProtocolVersion, "MCP protocol version requested from MCPs in the initialize handshake")
+	noServerInfo := flag.Bool("no-server-info", false, "Don't serve the server_info and describe_mcp tools over stdio and SSE")
+	passthrough := flag.Bool("passthrough", false, "Serve the tools of a single MCP without the MCP name prefix (fails if more than one MCP is present)")
+	coalesce := flag.Bool("coalesce", false, "Share one execution between concurrent calls of a tool with identical arguments (only for idempotent tools)")
+	logPayloads := flag.Bool("log-payloads", false, "Log the arguments and results of tool calls; values of -redact keys are masked")
+	var aliases, allowPatterns, denyPatterns, redactKeys stringList
+	flag.Var(&aliases, "alias", "Expose a tool under another name, as alias=mcpName.toolName (repeatable or comma-separated)")
+	flag.Var(&allowPatterns, "allow", "Glob pattern of tools to serve, matched against mcpName.toolName (repeatable or comma-separated)")
+	flag.Var(&redactKeys, "redact", "Argument key whose values are masked in logged payloads, matched case-insensitively (repeatable or comma-separated)")
+	flag.Var(&denyPatterns, "deny", "Glob pattern of tools to hide, matched against mcpName.toolName (repeatable or comma-separated)")
+	maxRequestBytes := flag.Int64("max-request-bytes", server.DefaultMaxRequestBytes, "Maximum size of an HTTP request body in bytes (0 for no limit)")
+	maxResultBytes := flag.Int("max-result-bytes", 0, "Maximum bytes of text in a tool result sent to clients, truncating the rest (0 for no limit)")
+	rateLimit := flag.Float64("rate-limit", 0, "Maximum HTTP requests per second per client IP (0 for no limit)")
+	rateBurst := flag.Int("rate-burst", 20, "Number of requests a client may make in a burst above -rate-limit")
+	accessLog := flag.Bool("access-log", false, "Log the client, JSON-RPC method, tool, status and duration of every HTTP request")
+	otelEndpoint := flag.String("otel-endpoint", "", "OTLP/HTTP endpoint to export trace spans to (e.g. http://localhost:4318); tracing is off if empty")
+	validate := flag.Bool("validate", false, "Load the MCPs, print a JSON report of their tools and load errors, and exit non-zero if any failed to load")
+	listTools := flag.Bool("list-tools", false, "Load the MCPs, print the tools they serve and exit")
+	listFormat := flag.String("list-format", "table", "Format of the -list-tools output: table or json")
+	pageSize := flag.Int("page-size", server.DefaultToolsPageSize, "Maximum tools per tools/list page (0 disables pagination)")
+	resultCacheSize := flag.Int("result-cache-size", server.DefaultResultCacheSize, "Maximum number of results cached for tools marked cacheable (0 disables the cache)")
 	flag.Parse()
 
-	// Ensure the MCP directory exists
-	if _, err := os.Stat(*mcpDirectory); os.IsNotExist(err) {
-		fmt.Fprintf(os.Stderr, "MCP directory does not exist: %s\n", *mcpDirectory)
-		if err := os.MkdirAll(*mcpDirectory, 0755); err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to create MCP directory: %v\n", err)
+	if *printVersion {
+		fmt.Println(buildinfo.Get().Describe("mcp-server"))
+		return
+	}
+
+	// Apply settings from the config file that weren't set by flags
+	var mcpConfigs map[string]server.MCPConfig
+	var launchers map[string][]string
+	if *configPath != "" {
+		cfg, err := config.Load(*configPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
 			os.Exit(1)
 		}
-		fmt.Fprintf(os.Stderr, "Created MCP directory: %s\n", *mcpDirectory)
+
+		setFlags := make(map[string]bool)
+		flag.Visit(func(f *flag.Flag) {
+			setFlags[f.Name] = true
+		})
+		for name, value := range cfg.FlagValues() {
+			if setFlags[name] {
+				continue
+			}
+			if err := flag.Set(name, value); err != nil {
+				fmt.Fprintf(os.Stderr, "Invalid config value for %s: %v\n", name, err)
+				os.Exit(1)
+			}
+		}
+		mcpConfigs = cfg.MCPs
+		launchers = cfg.Launchers
 	}
 
-	// Get the absolute path of the MCP directory
-	absPath, err := filepath.Abs(*mcpDirectory)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to get absolute path of MCP directory: %v\n", err)
+	if *transport != "http" && *transport != "sse" {
+		fmt.Fprintf(os.Stderr, "Invalid transport %q, expected http or sse\n", *transport)
 		os.Exit(1)
 	}
+	if *listFormat != "table" && *listFormat != "json" {
+		fmt.Fprintf(os.Stderr, "Invalid list format %q, expected table or json\n", *listFormat)
+		os.Exit(1)
+	}
+
+	// Export trace spans if requested. Spans still buffered are flushed
+	// before the process exits.
+	flushTracing := func() {}
+	if *otelEndpoint != "" {
+		shutdownTracing, err := telemetry.Setup(context.Background(), *otelEndpoint, *name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to set up tracing: %v\n", err)
+			os.Exit(1)
+		}
+		flushTracing = func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := shutdownTracing(ctx); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: Failed to flush trace spans: %v\n", err)
+			}
+		}
+	}
+	defer flushTracing()
+
+	if len(mcpDirectories) == 0 {
+		mcpDirectories = stringList{"./mcps"}
+	}
+
+	// Ensure the MCP directories exist, unless the MCPs are listed in a
+	// manifest. A missing directory fails validation instead.
+	absPaths := make([]string, 0, len(mcpDirectories))
+	for _, mcpDirectory := range mcpDirectories {
+		if _, err := os.Stat(mcpDirectory); os.IsNotExist(err) && !*validate && !*listTools && *mcpManifest == "" {
+			fmt.Fprintf(os.Stderr, "MCP directory does not exist: %s\n", mcpDirectory)
+			if err := os.MkdirAll(mcpDirectory, 0755); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to create MCP directory: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Fprintf(os.Stderr, "Created MCP directory: %s\n", mcpDirectory)
+		}
+
+		// Get the absolute path of the MCP directory
+		absPath, err := filepath.Abs(mcpDirectory)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to get absolute path of MCP directory: %v\n", err)
+			os.Exit(1)
+		}
+		absPaths = append(absPaths, absPath)
+	}
 
 	// Create the MCP server
-	mcpServer, err := server.NewMCPServer(absPath, *name, *version)
+	aliasMap := make(map[string]string, len(aliases))
+	for _, entry := range aliases {
+		alias, target, ok := strings.Cut(entry, "=")
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Invalid alias %q, expected alias=mcpName.toolName\n", entry)
+			os.Exit(1)
+		}
+		aliasMap[strings.TrimSpace(alias)] = strings.TrimSpace(target)
+	}
+
+	opts := []server.ServerOption{
+		server.WithToolsPageSize(*pageSize),
+		server.WithReadyRequiresAllMCPs(*readyRequireAll),
+		server.WithArgumentLimits(*maxArgDepth, *maxArgElements),
+		server.WithMaskErrors(*maskErrors),
+		server.WithStrict(*strict),
+		server.WithCircuitBreaker(*breakerThreshold, *breakerWindow, *breakerCooldown),
+		server.WithMCPDirectories(absPaths),
+		server.WithDirectoryConflicts(*dirConflicts),
+		server.WithMCPConfigs(mcpConfigs),
+		server.WithLaunchers(launchers),
+		server.WithToolFilter(allowPatterns, denyPatterns),
+		server.WithAliases(aliasMap),
+		server.WithMaxRequestBytes(*maxRequestBytes),
+		server.WithMaxResultBytes(*maxResultBytes),
+		server.WithRateLimit(*rateLimit, *rateBurst),
+		server.WithAccessLog(*accessLog),
+		server.WithPayloadLogging(*logPayloads, redactKeys),
+		server.WithCoalescing(*coalesce),
+		server.WithPassthrough(*passthrough),
+		server.WithServerInfoTool(!*noServerInfo),
+		server.WithProtocolVersion(*protocolVersion),
+		server.WithTimeouts(*discoveryTimeout, *execTimeout),
+		server.WithFailIfEmpty(*failIfEmpty),
+		server.WithManifestList(*mcpManifest),
+		server.WithResultCacheSize(*resultCacheSize),
+	}
+
+	// Cache discovered tools across restarts unless disabled. Validation
+	// always queries the MCPs.
+	if !*noCache && !*validate {
+		cachePath, err := server.DefaultToolCachePath()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Tool cache disabled: %v\n", err)
+		} else {
+			opts = append(opts, server.WithToolCache(cachePath))
+		}
+	}
+
+	mcpServer, err := server.NewMCPServer(absPaths[0], *name, *version, opts...)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to create MCP server: %v\n", err)
 		os.Exit(1)
 	}
+	defer func() {
+		if err := mcpServer.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to close MCP server: %v\n", err)
+		}
+	}()
+
+	// Report on the MCPs without serving them if validating
+	if *validate {
+		report := mcpServer.Validate()
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write validation report: %v\n", err)
+			os.Exit(1)
+		}
+		if !report.Valid {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Print the tool catalog without serving it if listing tools
+	if *listTools {
+		if err := printTools(os.Stdout, mcpServer.Tools(), *listFormat); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to list tools: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Periodically check MCP health if requested
+	if *healthInterval > 0 {
+		mcpServer.StartHealthChecks(context.Background(), *healthInterval)
+	}
+
+	// Stop idle persistent MCPs if requested
+	if *idleTimeout > 0 {
+		mcpServer.StartIdleReaper(context.Background(), *idleTimeout)
+	}
+
+	// Listen up front so the socket can be handed over on a graceful restart
+	var ln net.Listener
+	if !*useStdio {
+		ln, err = listen(listenFDEnv, *httpAddr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to listen on %s: %v\n", *httpAddr, err)
+			os.Exit(1)
+		}
+	}
+
+	// Serve the admin API alongside the MCP server if requested
+	var adminLn net.Listener
+	if *adminAddr != "" {
+		token := *adminToken
+		if token == "" {
+			token = os.Getenv("MCP_SERVER_ADMIN_TOKEN")
+		}
+		if token == "" {
+			fmt.Fprintf(os.Stderr, "The admin API requires -admin-token or $MCP_SERVER_ADMIN_TOKEN\n")
+			os.Exit(1)
+		}
+
+		adminLn, err = listen(adminListenFDEnv, *adminAddr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to listen on %s: %v\n", *adminAddr, err)
+			os.Exit(1)
+		}
+
+		fmt.Fprintf(os.Stderr, "Serving admin API on %s\n", adminLn.Addr())
+		go func() {
+			if err := mcpServer.ServeAdminListener(adminLn, token); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				fmt.Fprintf(os.Stderr, "Admin server error: %v\n", err)
+			}
+		}()
+	}
+
+	// Serve the tools over gRPC alongside the MCP server if requested
+	var grpcLn net.Listener
+	if *grpcAddr != "" {
+		grpcLn, err = listen(grpcListenFDEnv, *grpcAddr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to listen on %s: %v\n", *grpcAddr, err)
+			os.Exit(1)
+		}
+
+		fmt.Fprintf(os.Stderr, "Serving gRPC on %s\n", grpcLn.Addr())
+		go func() {
+			if err := mcpServer.ServeGRPCListener(grpcLn); err != nil {
+				fmt.Fprintf(os.Stderr, "gRPC server error: %v\n", err)
+			}
+		}()
+	}
 
-	// Set up signal handling for graceful shutdown
+	// Set up signal handling for graceful shutdown and restart
+	shutdownDone := make(chan struct{})
 	signals := make(chan os.Signal, 1)
-	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	signal.Notify(signals, append([]os.Signal{syscall.SIGINT, syscall.SIGTERM}, restartSignals...)...)
 	go func() {
-		sig := <-signals
-		fmt.Fprintf(os.Stderr, "Received signal %v, shutting down...\n", sig)
-		os.Exit(0)
+		for sig := range signals {
+			if ln == nil || !isRestartSignal(sig) {
+				fmt.Fprintf(os.Stderr, "Received signal %v, shutting down...\n", sig)
+
+				// Let in-flight tool calls finish before the subprocesses
+				// are stopped
+				ctx, cancel := context.WithTimeout(context.Background(), *drainTimeout)
+				if err := mcpServer.Drain(ctx); err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to drain in-flight requests: %v\n", err)
+				}
+				cancel()
+				flushTracing()
+				os.Exit(0)
+			}
+
+			fmt.Fprintf(os.Stderr, "Received signal %v, restarting...\n", sig)
+			if err := reexec(ln, adminLn, grpcLn); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to restart: %v\n", err)
+				continue
+			}
+
+			// Let the new process take over the listener while in-flight
+			// requests finish here
+			ctx, cancel := context.WithTimeout(context.Background(), *drainTimeout)
+			if err := mcpServer.Shutdown(ctx); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to drain in-flight requests: %v\n", err)
+			}
+			cancel()
+			close(shutdownDone)
+			return
+		}
 	}()
 
 	// Start the server
@@ -58,13 +352,54 @@ func main() {
 	if *useStdio {
 		fmt.Fprintf(os.Stderr, "Starting MCP server in stdio mode\n")
 		serverErr = mcpServer.ServeStdio()
+	} else if *transport == "sse" {
+		fmt.Fprintf(os.Stderr, "Starting MCP server in SSE mode on %s\n", ln.Addr())
+		serverErr = mcpServer.ServeSSEListener(ln)
 	} else {
-		fmt.Fprintf(os.Stderr, "Starting MCP server in HTTP mode on %s\n", *httpAddr)
-		serverErr = mcpServer.ServeHTTP(*httpAddr)
+		fmt.Fprintf(os.Stderr, "Starting MCP server in HTTP mode on %s\n", ln.Addr())
+		serverErr = mcpServer.ServeHTTPListener(ln)
+	}
+
+	// The server was shut down to hand over to a restarted process
+	if errors.Is(serverErr, http.ErrServerClosed) {
+		<-shutdownDone
+		fmt.Fprintf(os.Stderr, "Handed over to new server process\n")
+		return
 	}
 
 	if serverErr != nil {
 		fmt.Fprintf(os.Stderr, "Server error: %v\n", serverErr)
+		mcpServer.Close()
+		flushTracing()
 		os.Exit(1)
 	}
 }
+
+// stringList is a flag that collects values from repeated and
+// comma-separated uses
+type stringList []string
+
+// String implements flag.Value
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+// Set implements flag.Value
+func (l *stringList) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
+
+// isRestartSignal reports whether sig requests a graceful restart
+func isRestartSignal(sig os.Signal) bool {
+	for _, restartSignal := range restartSignals {
+		if sig == restartSignal {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,30 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors"
+	"net"
+	"os"
+)
+
+// restartSignals trigger a graceful restart; there are none on this platform
+var restartSignals []os.Signal
+
+// listenFDEnv, adminListenFDEnv and grpcListenFDEnv are unused on this
+// platform
+const (
+	listenFDEnv      = ""
+	adminListenFDEnv = ""
+	grpcListenFDEnv  = ""
+)
+
+// listen returns a new listener on addr
+func listen(fdEnv, addr string) (net.Listener, error) {
+	return net.Listen("tcp", addr)
+}
+
+// reexec is not supported on this platform
+func reexec(ln, adminLn, grpcLn net.Listener) error {
+	return errors.New("graceful restart is not supported on this platform")
+}
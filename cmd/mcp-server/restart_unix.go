@@ -0,0 +1,107 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+)
+
+// listenFDEnv, adminListenFDEnv and grpcListenFDEnv name the environment
+// variables through which a restarting server tells the new process which
+// file descriptors hold its listeners
+const (
+	listenFDEnv      = "MCP_SERVER_LISTEN_FD"
+	adminListenFDEnv = "MCP_SERVER_ADMIN_LISTEN_FD"
+	grpcListenFDEnv  = "MCP_SERVER_GRPC_LISTEN_FD"
+)
+
+// restartSignals trigger a graceful restart
+var restartSignals = []os.Signal{syscall.SIGHUP}
+
+// listen returns the listener inherited from a restarting parent process
+// through the file descriptor named by fdEnv, or a new listener on addr
+func listen(fdEnv, addr string) (net.Listener, error) {
+	fdValue := os.Getenv(fdEnv)
+	if fdValue == "" {
+		return net.Listen("tcp", addr)
+	}
+	os.Unsetenv(fdEnv)
+
+	fd, err := strconv.Atoi(fdValue)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", fdEnv, err)
+	}
+
+	file := os.NewFile(uintptr(fd), "listener")
+	defer file.Close()
+
+	ln, err := net.FileListener(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inherit listener: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "Inherited listener on %s\n", ln.Addr())
+	return ln, nil
+}
+
+// reexec starts a new copy of the running binary with the same arguments,
+// handing it ln and, if not nil, adminLn and grpcLn so no connections are
+// refused while the switch happens
+func reexec(ln, adminLn, grpcLn net.Listener) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find executable: %w", err)
+	}
+
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = os.Environ()
+
+	// ExtraFiles start at file descriptor 3 in the child
+	for _, inherited := range []struct {
+		ln    net.Listener
+		fdEnv string
+	}{
+		{ln, listenFDEnv},
+		{adminLn, adminListenFDEnv},
+		{grpcLn, grpcListenFDEnv},
+	} {
+		if inherited.ln == nil {
+			continue
+		}
+		file, err := listenerFile(inherited.ln)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		cmd.ExtraFiles = append(cmd.ExtraFiles, file)
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%d", inherited.fdEnv, 2+len(cmd.ExtraFiles)))
+	}
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start new process: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "Started new server process %d\n", cmd.Process.Pid)
+	return nil
+}
+
+// listenerFile returns a duplicate of the file descriptor behind ln
+func listenerFile(ln net.Listener) (*os.File, error) {
+	fileListener, ok := ln.(interface{ File() (*os.File, error) })
+	if !ok {
+		return nil, errors.New("listener does not support file descriptor inheritance")
+	}
+	file, err := fileListener.File()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get listener file: %w", err)
+	}
+	return file, nil
+}
@@ -0,0 +1,219 @@
+// Package config loads mcp-server settings from a YAML or JSON file.
+package config
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/mcp-net/mcp-proxy/server"
+)
+
+// Config holds the settings read from a config file. Keys match the names
+// of the mcp-server command line flags; settings left out of the file are
+// nil and don't override anything.
+type Config struct {
+	MCPDir    stringOrList `yaml:"mcp-dir"`
+	HTTPAddr  *string      `yaml:"http"`
+	Transport *string      `yaml:"transport"`
+	Name      *string      `yaml:"name"`
+	Version   *string      `yaml:"version"`
+	Stdio     *bool        `yaml:"stdio"`
+	NoCache   *bool        `yaml:"no-cache"`
+	PageSize  *int         `yaml:"page-size"`
+
+	OTelEndpoint    *string `yaml:"otel-endpoint"`
+	ProtocolVersion *string `yaml:"protocol-version"`
+	MCPManifest     *string `yaml:"mcp-manifest"`
+	MCPDirConflict  *string `yaml:"mcp-dir-conflict"`
+
+	AdminAddr  *string `yaml:"admin-addr"`
+	AdminToken *string `yaml:"admin-token"`
+	GRPCAddr   *string `yaml:"grpc-addr"`
+
+	ReadyRequireAll *bool `yaml:"ready-require-all"`
+	MaskErrors      *bool `yaml:"mask-errors"`
+	Strict          *bool `yaml:"strict"`
+	LogPayloads     *bool `yaml:"log-payloads"`
+	AccessLog       *bool `yaml:"access-log"`
+	Coalesce        *bool `yaml:"coalesce"`
+	Passthrough     *bool `yaml:"passthrough"`
+	NoServerInfo    *bool `yaml:"no-server-info"`
+	FailIfEmpty     *bool `yaml:"fail-if-empty"`
+	MaxArgDepth     *int  `yaml:"max-arg-depth"`
+	MaxArgElements  *int  `yaml:"max-arg-elements"`
+	ResultCacheSize *int  `yaml:"result-cache-size"`
+	MaxResultBytes  *int  `yaml:"max-result-bytes"`
+
+	MaxRequestBytes *int64   `yaml:"max-request-bytes"`
+	RateLimit       *float64 `yaml:"rate-limit"`
+	RateBurst       *int     `yaml:"rate-burst"`
+
+	HealthInterval   *time.Duration `yaml:"health-interval"`
+	BreakerThreshold *int           `yaml:"breaker-threshold"`
+	BreakerWindow    *time.Duration `yaml:"breaker-window"`
+	BreakerCooldown  *time.Duration `yaml:"breaker-cooldown"`
+	DrainTimeout     *time.Duration `yaml:"drain-timeout"`
+	IdleTimeout      *time.Duration `yaml:"idle-timeout"`
+	DiscoveryTimeout *time.Duration `yaml:"discovery-timeout"`
+	ExecTimeout      *time.Duration `yaml:"exec-timeout"`
+
+	Allow []string `yaml:"allow"`
+	Deny  []string `yaml:"deny"`
+
+	// Redact lists argument keys masked in logged payloads
+	Redact []string `yaml:"redact"`
+
+	// Aliases maps alternative tool names to namespaced tools
+	Aliases map[string]string `yaml:"aliases"`
+
+	// Launchers maps script extensions to the commands that run them, e.g.
+	// ".ts": ["deno", "run", "{path}"]. An entry replaces the default for
+	// its extension, and an empty list removes it.
+	Launchers map[string][]string `yaml:"launchers"`
+
+	// MCPs holds per-MCP settings keyed by MCP name. An entry replaces the
+	// manifest next to that MCP's executable.
+	MCPs map[string]server.MCPConfig `yaml:"mcps"`
+}
+
+// Load reads the config file at path. JSON files are accepted as well, since
+// JSON is valid YAML.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var config Config
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+
+	return &config, nil
+}
+
+// FlagValues returns the settings present in the file as command line flag
+// names and values, ready to be applied with flag.Set
+func (c *Config) FlagValues() map[string]string {
+	values := make(map[string]string)
+
+	setString := func(name string, value *string) {
+		if value != nil {
+			values[name] = *value
+		}
+	}
+	setBool := func(name string, value *bool) {
+		if value != nil {
+			values[name] = strconv.FormatBool(*value)
+		}
+	}
+	setInt := func(name string, value *int) {
+		if value != nil {
+			values[name] = strconv.Itoa(*value)
+		}
+	}
+	setInt64 := func(name string, value *int64) {
+		if value != nil {
+			values[name] = strconv.FormatInt(*value, 10)
+		}
+	}
+	setFloat := func(name string, value *float64) {
+		if value != nil {
+			values[name] = strconv.FormatFloat(*value, 'g', -1, 64)
+		}
+	}
+	setDuration := func(name string, value *time.Duration) {
+		if value != nil {
+			values[name] = value.String()
+		}
+	}
+
+	setString("http", c.HTTPAddr)
+	setString("transport", c.Transport)
+	setString("name", c.Name)
+	setString("version", c.Version)
+	setBool("stdio", c.Stdio)
+	setBool("no-cache", c.NoCache)
+	setString("otel-endpoint", c.OTelEndpoint)
+	setString("protocol-version", c.ProtocolVersion)
+	setString("mcp-manifest", c.MCPManifest)
+	setString("mcp-dir-conflict", c.MCPDirConflict)
+	setString("admin-addr", c.AdminAddr)
+	setString("admin-token", c.AdminToken)
+	setString("grpc-addr", c.GRPCAddr)
+	setInt("page-size", c.PageSize)
+
+	setBool("ready-require-all", c.ReadyRequireAll)
+	setBool("mask-errors", c.MaskErrors)
+	setBool("strict", c.Strict)
+	setBool("log-payloads", c.LogPayloads)
+	setBool("access-log", c.AccessLog)
+	setBool("coalesce", c.Coalesce)
+	setBool("passthrough", c.Passthrough)
+	setBool("no-server-info", c.NoServerInfo)
+	setBool("fail-if-empty", c.FailIfEmpty)
+	setInt("max-arg-depth", c.MaxArgDepth)
+	setInt("max-arg-elements", c.MaxArgElements)
+	setInt("result-cache-size", c.ResultCacheSize)
+	setInt("max-result-bytes", c.MaxResultBytes)
+	setInt64("max-request-bytes", c.MaxRequestBytes)
+	setFloat("rate-limit", c.RateLimit)
+	setInt("rate-burst", c.RateBurst)
+
+	setDuration("health-interval", c.HealthInterval)
+	setInt("breaker-threshold", c.BreakerThreshold)
+	setDuration("breaker-window", c.BreakerWindow)
+	setDuration("breaker-cooldown", c.BreakerCooldown)
+	setDuration("drain-timeout", c.DrainTimeout)
+	setDuration("idle-timeout", c.IdleTimeout)
+	setDuration("discovery-timeout", c.DiscoveryTimeout)
+	setDuration("exec-timeout", c.ExecTimeout)
+
+	if len(c.MCPDir) > 0 {
+		values["mcp-dir"] = strings.Join(c.MCPDir, ",")
+	}
+	if len(c.Allow) > 0 {
+		values["allow"] = strings.Join(c.Allow, ",")
+	}
+	if len(c.Deny) > 0 {
+		values["deny"] = strings.Join(c.Deny, ",")
+	}
+	if len(c.Redact) > 0 {
+		values["redact"] = strings.Join(c.Redact, ",")
+	}
+	if len(c.Aliases) > 0 {
+		aliases := make([]string, 0, len(c.Aliases))
+		for alias, target := range c.Aliases {
+			aliases = append(aliases, alias+"="+target)
+		}
+		sort.Strings(aliases)
+		values["alias"] = strings.Join(aliases, ",")
+	}
+
+	return values
+}
+
+// stringOrList is a setting given either as a single string or as a list of
+// strings
+type stringOrList []string
+
+// UnmarshalYAML implements yaml.Unmarshaler
+func (l *stringOrList) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*l = stringOrList{node.Value}
+		return nil
+	}
+
+	var values []string
+	if err := node.Decode(&values); err != nil {
+		return err
+	}
+	*l = values
+	return nil
+}
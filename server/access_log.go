@@ -0,0 +1,124 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// accessEntry collects what the access log line of an HTTP request reports
+// about the JSON-RPC messages in its body
+type accessEntry struct {
+	methods []string
+	tools   []string
+}
+
+// accessEntryKey is the context key under which the access entry of an HTTP
+// request is stored
+type accessEntryKey struct{}
+
+// accessEntryFrom returns the access entry of the request ctx belongs to, or
+// nil if access logging is off
+func accessEntryFrom(ctx context.Context) *accessEntry {
+	entry, _ := ctx.Value(accessEntryKey{}).(*accessEntry)
+	return entry
+}
+
+// describe records the methods called in body, a single JSON-RPC message or
+// a batch, and the tools named by tool calls
+func (e *accessEntry) describe(body []byte) {
+	messages := []json.RawMessage{body}
+	if isBatch(body) {
+		if err := json.Unmarshal(body, &messages); err != nil {
+			return
+		}
+	}
+
+	for _, message := range messages {
+		var request struct {
+			Method string `json:"method"`
+			Params struct {
+				Name string `json:"name"`
+			} `json:"params"`
+		}
+		if err := json.Unmarshal(message, &request); err != nil || request.Method == "" {
+			continue
+		}
+		e.methods = append(e.methods, request.Method)
+		if request.Method == "tools/call" && request.Params.Name != "" {
+			e.tools = append(e.tools, request.Params.Name)
+		}
+	}
+}
+
+// statusRecorder records the status code written to a response. It passes
+// flushes through so streamed responses still work.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader implements http.ResponseWriter
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Write implements http.ResponseWriter
+func (r *statusRecorder) Write(data []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(data)
+}
+
+// Flush implements http.Flusher
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap returns the underlying response writer for http.ResponseController
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// accessLogged logs a line to stderr for each request served by handler
+// once it is answered, if access logging is enabled
+func (s *MCPServer) accessLogged(handler http.Handler) http.Handler {
+	if !s.accessLog {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		entry := &accessEntry{}
+		recorder := &statusRecorder{ResponseWriter: w}
+		handler.ServeHTTP(recorder, r.WithContext(context.WithValue(r.Context(), accessEntryKey{}, entry)))
+
+		status := recorder.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		// The audit trail is written regardless of the log level, which
+		// clients can change
+		fmt.Fprintf(os.Stderr, "access time=%s remote=%s method=%s tool=%s status=%d duration=%s\n",
+			start.UTC().Format(time.RFC3339Nano), r.RemoteAddr, accessField(entry.methods),
+			accessField(entry.tools), status, time.Since(start))
+	})
+}
+
+// accessField formats values for an access log line, comma-separated, or
+// "-" if there are none
+func accessField(values []string) string {
+	if len(values) == 0 {
+		return "-"
+	}
+	return strings.Join(values, ",")
+}
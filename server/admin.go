@@ -0,0 +1,109 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ServeAdminListener serves the admin API on ln. Every request must carry
+// token as a bearer token in its Authorization header.
+//
+//	GET  /mcps                        inventory of MCPs with status and health
+//	POST /mcps/reload                 rescan the MCP directory
+//	POST /mcps/{name}/enable|disable  toggle serving an MCP's tools
+//	POST /groups/{group}/enable|disable|reload
+func (s *MCPServer) ServeAdminListener(ln net.Listener, token string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /mcps", s.handleAdminList)
+	mux.HandleFunc("POST /mcps/reload", s.handleAdminReload)
+	mux.HandleFunc("POST /mcps/{name}/enable", s.handleAdminSetMCPEnabled(true))
+	mux.HandleFunc("POST /mcps/{name}/disable", s.handleAdminSetMCPEnabled(false))
+	mux.HandleFunc("POST /groups/{group}/enable", s.handleAdminSetGroupEnabled(true))
+	mux.HandleFunc("POST /groups/{group}/disable", s.handleAdminSetGroupEnabled(false))
+	mux.HandleFunc("POST /groups/{group}/reload", s.handleAdminReloadGroup)
+
+	server := &http.Server{
+		Handler: requireBearerToken(token, mux),
+	}
+
+	s.httpMutex.Lock()
+	s.adminServer = server
+	s.httpMutex.Unlock()
+
+	return server.Serve(ln)
+}
+
+// requireBearerToken rejects requests that don't carry token as a bearer
+// token
+func requireBearerToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		supplied, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(supplied), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleAdminList reports every MCP with its status and health, along with
+// the errors from the last load
+func (s *MCPServer) handleAdminList(w http.ResponseWriter, r *http.Request) {
+	writeAdminJSON(w, map[string]interface{}{
+		"mcps":       s.mcpManager.GetMCPSummaries(),
+		"loadErrors": s.mcpManager.LoadErrors(),
+	})
+}
+
+// handleAdminReload rescans the MCP directory
+func (s *MCPServer) handleAdminReload(w http.ResponseWriter, r *http.Request) {
+	if err := s.Reload(r.Context()); err != nil {
+		http.Error(w, s.clientError("Failed to reload MCPs", err), http.StatusInternalServerError)
+		return
+	}
+	s.handleAdminList(w, r)
+}
+
+// handleAdminSetMCPEnabled returns a handler that enables or disables the
+// MCP named in the path
+func (s *MCPServer) handleAdminSetMCPEnabled(enabled bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		if err := s.SetMCPEnabled(name, enabled); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		writeAdminJSON(w, map[string]interface{}{"name": name, "enabled": enabled})
+	}
+}
+
+// handleAdminSetGroupEnabled returns a handler that enables or disables the
+// group named in the path
+func (s *MCPServer) handleAdminSetGroupEnabled(enabled bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		group := r.PathValue("group")
+		s.SetGroupEnabled(group, enabled)
+		writeAdminJSON(w, map[string]interface{}{"group": group, "enabled": enabled})
+	}
+}
+
+// handleAdminReloadGroup rediscovers the tools of the group named in the path
+func (s *MCPServer) handleAdminReloadGroup(w http.ResponseWriter, r *http.Request) {
+	if err := s.ReloadGroup(r.Context(), r.PathValue("group")); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	s.handleAdminList(w, r)
+}
+
+// writeAdminJSON writes value as an indented JSON response
+func writeAdminJSON(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(value)
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SetAliases exposes tools under alternative names. aliases maps each alias
+// to the namespaced tool it stands for, e.g. "add" to "calculator-mcp.add".
+// Aliased tools are listed under their alias; both names can be called.
+func (m *MCPManager) SetAliases(aliases map[string]string) error {
+	byTarget := make(map[string]string, len(aliases))
+	for alias, target := range aliases {
+		if alias == "" {
+			return fmt.Errorf("empty alias for tool %s", target)
+		}
+		if !strings.Contains(target, ToolNameSeparator) {
+			return fmt.Errorf("invalid alias target for %s, expected 'mcp.tool': %s", alias, target)
+		}
+		if other, ok := byTarget[target]; ok {
+			return fmt.Errorf("tool %s has more than one alias: %s, %s", target, other, alias)
+		}
+		byTarget[target] = alias
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.aliases = make(map[string]string, len(aliases))
+	for alias, target := range aliases {
+		m.aliases[alias] = target
+	}
+	m.checkAliasesLocked()
+	return nil
+}
+
+// checkAliasesLocked rebuilds the active aliases after the loaded tools
+// changed. An alias that collides with the name of a loaded tool is dropped
+// and recorded as a load error. The caller must hold the write lock.
+func (m *MCPManager) checkAliasesLocked() {
+	m.aliasByTarget = make(map[string]string, len(m.aliases))
+	for alias, target := range m.aliases {
+		if m.hasToolLocked(alias) {
+			err := fmt.Errorf("alias %s for %s collides with an existing tool", alias, target)
+			m.logf("warning", "Warning: %v\n", err)
+			m.loadErrors = append(m.loadErrors, LoadError{Path: alias, Error: err.Error()})
+			continue
+		}
+		m.aliasByTarget[target] = alias
+	}
+}
+
+// hasToolLocked reports whether a loaded MCP provides the namespaced tool.
+// The caller must hold the lock.
+func (m *MCPManager) hasToolLocked(toolName string) bool {
+	mcpName, localToolName, ok := m.splitToolNameLocked(toolName)
+	if !ok {
+		return false
+	}
+	mcpInfo, ok := m.mcpMap[mcpName]
+	if !ok {
+		return false
+	}
+	for _, tool := range mcpInfo.ToolInfos {
+		if tool.Name == localToolName {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveAlias returns the namespaced tool an active alias stands for, or
+// toolName itself. The caller must hold the lock.
+func (m *MCPManager) resolveAlias(toolName string) string {
+	if target, ok := m.aliases[toolName]; ok && m.aliasByTarget[target] == toolName {
+		return target
+	}
+	return toolName
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// isBatch reports whether raw is a JSON-RPC batch, i.e. a JSON array
+func isBatch(raw []byte) bool {
+	trimmed := bytes.TrimLeft(raw, " \t\r\n")
+	return len(trimmed) > 0 && trimmed[0] == '['
+}
+
+// processBatch runs handle on every element of the batch in raw concurrently
+// and returns the JSON array of their responses in request order. Elements
+// that produce no response, such as notifications, are left out, and nil is
+// returned when none of them respond.
+func processBatch(raw []byte, handle func(element json.RawMessage) []byte) ([]byte, error) {
+	var elements []json.RawMessage
+	if err := json.Unmarshal(raw, &elements); err != nil {
+		return nil, fmt.Errorf("failed to parse batch: %w", err)
+	}
+
+	// An empty batch is itself an invalid request
+	if len(elements) == 0 {
+		return newErrorResponse(nil, -32600, "Invalid Request: empty batch")
+	}
+
+	responses := make([][]byte, len(elements))
+	var wg sync.WaitGroup
+	for i, element := range elements {
+		wg.Add(1)
+		go func(i int, element json.RawMessage) {
+			defer wg.Done()
+			responses[i] = handle(element)
+		}(i, element)
+	}
+	wg.Wait()
+
+	batch := make([]json.RawMessage, 0, len(responses))
+	for _, response := range responses {
+		if response != nil {
+			batch = append(batch, response)
+		}
+	}
+	if len(batch) == 0 {
+		return nil, nil
+	}
+
+	return marshalResponse(batch)
+}
+
+// processBatchElement handles one element of an HTTP batch, turning failures
+// into JSON-RPC error responses since the batch as a whole still succeeds
+func (s *MCPServer) processBatchElement(element json.RawMessage, process func([]byte) ([]byte, error)) []byte {
+	var request struct {
+		ID json.RawMessage `json:"id"`
+	}
+	if err := json.Unmarshal(element, &request); err != nil {
+		response, _ := newErrorResponse(nil, -32600, "Invalid Request")
+		return response
+	}
+
+	response, err := process(element)
+	if err != nil {
+		return s.processingErrorResponse(element, err)
+	}
+	return response
+}
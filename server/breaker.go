@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Default circuit breaker settings
+const (
+	DefaultBreakerThreshold = 5
+	DefaultBreakerWindow    = time.Minute
+	DefaultBreakerCooldown  = 30 * time.Second
+)
+
+// ErrCircuitOpen is returned for calls to an MCP whose circuit breaker is open
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// circuitBreaker records consecutive failures of an MCP. While open, calls
+// fail fast; after the cooldown a single trial call is let through
+// (half-open) and its outcome closes or reopens the breaker.
+type circuitBreaker struct {
+	failures     int
+	firstFailure time.Time
+	open         bool
+	openedAt     time.Time
+	trialRunning bool
+}
+
+// SetCircuitBreaker configures the circuit breaker applied to every MCP.
+// A threshold of zero or less disables it.
+func (m *MCPManager) SetCircuitBreaker(threshold int, window, cooldown time.Duration) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.breakerThreshold = threshold
+	m.breakerWindow = window
+	m.breakerCooldown = cooldown
+}
+
+// allowCall returns ErrCircuitOpen if calls to mcpInfo should fail fast
+func (m *MCPManager) allowCall(mcpInfo *MCPInfo) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	breaker := &mcpInfo.breaker
+	if m.breakerThreshold <= 0 || !breaker.open {
+		return nil
+	}
+
+	retryIn := m.breakerCooldown - time.Since(breaker.openedAt)
+	if retryIn > 0 || breaker.trialRunning {
+		if retryIn < 0 {
+			retryIn = 0
+		}
+		return fmt.Errorf("%w for MCP %s, retry in %s", ErrCircuitOpen, mcpInfo.Name, retryIn.Round(time.Second))
+	}
+
+	// Half-open: let this call through to test whether the MCP recovered
+	breaker.trialRunning = true
+	return nil
+}
+
+// recordCallResult updates the circuit breaker of mcpInfo with the outcome
+// of a call. Errors reported by the tool itself and calls cancelled by the
+// client don't count as failures of the MCP.
+func (m *MCPManager) recordCallResult(ctx context.Context, mcpInfo *MCPInfo, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.breakerThreshold <= 0 {
+		return
+	}
+
+	breaker := &mcpInfo.breaker
+	wasTrial := breaker.trialRunning
+	breaker.trialRunning = false
+
+	var toolErr *ToolError
+	if err == nil || errors.As(err, &toolErr) {
+		if breaker.open {
+			m.logf("info", "Circuit breaker closed for MCP %s\n", mcpInfo.Name)
+		}
+		*breaker = circuitBreaker{}
+		return
+	}
+	if ctx.Err() != nil && !wasTrial {
+		return
+	}
+
+	// A failed trial reopens the breaker for another cooldown
+	if wasTrial {
+		breaker.openedAt = time.Now()
+		m.logf("warning", "Warning: Circuit breaker reopened for MCP %s: %v\n", mcpInfo.Name, err)
+		return
+	}
+
+	now := time.Now()
+	if breaker.failures == 0 || now.Sub(breaker.firstFailure) > m.breakerWindow {
+		breaker.failures = 0
+		breaker.firstFailure = now
+	}
+	breaker.failures++
+
+	if breaker.failures >= m.breakerThreshold {
+		breaker.open = true
+		breaker.openedAt = now
+		m.logf("warning", "Warning: Circuit breaker opened for MCP %s after %d failures: %v\n", mcpInfo.Name, breaker.failures, err)
+	}
+}
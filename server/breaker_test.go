@@ -0,0 +1,47 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestCallTimeoutsOpenCircuitBreaker(t *testing.T) {
+	// An MCP that lists its tools but never answers a call, even once its
+	// stdin is closed
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+	hanging := handshakeThen(func(stdin *bufio.Reader, stdout io.Writer) *ProcessExitError {
+		for {
+			line, err := stdin.ReadBytes('\n')
+			var message rpcMessage
+			if json.Unmarshal(line, &message) == nil && message.Method == "tools/list" {
+				writeReply(stdout, message, echoToolsReply())
+			}
+			if err != nil {
+				<-release
+				return &ProcessExitError{ExitCode: 0}
+			}
+		}
+	})
+	s := newFakeServer(t, hanging,
+		WithTimeouts(5*time.Second, 50*time.Millisecond),
+		WithCircuitBreaker(2, time.Minute, time.Minute))
+
+	toolName := "echo" + ToolNameSeparator + "say"
+	for i := 0; i < 2; i++ {
+		_, err := s.mcpManager.ExecuteTool(context.Background(), toolName, nil, nil)
+		if !errors.Is(err, ErrToolTimeout) {
+			t.Fatalf("call %d: error = %v, want ErrToolTimeout", i+1, err)
+		}
+	}
+
+	_, err := s.mcpManager.ExecuteTool(context.Background(), toolName, nil, nil)
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("error = %v, want ErrCircuitOpen after repeated timeouts", err)
+	}
+}
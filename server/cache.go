@@ -0,0 +1,264 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// toolCacheVersion is bumped when the cached tool information changes shape
+// or meaning, so entries written by older servers are discovered again.
+// Version 1 added input schemas, which were previously lost, version 2 the
+// protocol version, version 3 capabilities, resources and prompts, and
+// version 4 the MCP's serverInfo and instructions.
+const toolCacheVersion = 4
+
+// toolCacheEntry records the tools discovered from an MCP together with the
+// state of its file at the time, so changes to the file invalidate it
+type toolCacheEntry struct {
+	Version int             `json:"version"`
+	ModTime time.Time       `json:"modTime"`
+	Size    int64           `json:"size"`
+	Config  json.RawMessage `json:"config"`
+
+	// ArgFiles records the files named in the MCP's arguments, such as the
+	// script run by an interpreter listed in a manifest
+	ArgFiles map[string]fileState `json:"argFiles,omitempty"`
+
+	// Launcher is the command template the MCP ran under, which isn't part
+	// of Config since it comes from the server's settings
+	Launcher []string `json:"launcher,omitempty"`
+
+	// RequestedVersion is the protocol version asked for
+	RequestedVersion string `json:"requestedVersion"`
+
+	mcpDiscovery
+}
+
+// fileState is the modification time and size of a file, a change to which
+// invalidates a cache entry
+type fileState struct {
+	ModTime time.Time `json:"modTime"`
+	Size    int64     `json:"size"`
+}
+
+// toolCache is an on-disk cache of discovered tools keyed by absolute MCP
+// path, letting unchanged MCPs skip the discovery handshake at startup
+type toolCache struct {
+	path    string
+	entries map[string]toolCacheEntry
+	dirty   bool
+}
+
+// DefaultToolCachePath returns the default location of the tool cache in
+// the user's cache directory
+func DefaultToolCachePath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find cache directory: %w", err)
+	}
+	return filepath.Join(dir, "mcp-server", "tools.json"), nil
+}
+
+// SetToolCache enables caching discovered tools in the file at path. A
+// missing file starts an empty cache, and an unreadable one is replaced.
+func (m *MCPManager) SetToolCache(path string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	cache := &toolCache{path: path, entries: make(map[string]toolCacheEntry)}
+
+	data, err := os.ReadFile(path)
+	if err == nil {
+		err = json.Unmarshal(data, &cache.entries)
+	}
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		m.logf("warning", "Warning: Ignoring tool cache %s: %v\n", path, err)
+		cache.entries = make(map[string]toolCacheEntry)
+	}
+
+	m.toolCache = cache
+}
+
+// toolCacheState returns the key of the cache entry of the MCP at mcpPath
+// and an entry, without tools, recording the current state of its file,
+// configuration and launcher. It returns false if the MCP can't be cached.
+// The caller must hold the lock.
+func (m *MCPManager) toolCacheState(mcpPath string, config MCPConfig) (string, toolCacheEntry, bool) {
+	if m.toolCache == nil {
+		return "", toolCacheEntry{}, false
+	}
+
+	key, keyErr := toolCacheKey(mcpPath, config)
+	info, statErr := os.Stat(mcpPath)
+	configJSON, configErr := json.Marshal(config)
+	if keyErr != nil || statErr != nil || configErr != nil {
+		return "", toolCacheEntry{}, false
+	}
+
+	return key, toolCacheEntry{
+		Version: toolCacheVersion,
+		ModTime: info.ModTime(),
+		Size:    info.Size(),
+		Config:  configJSON,
+
+		ArgFiles: argFileStates(mcpPath, config),
+		Launcher: config.launcher,
+
+		RequestedVersion: m.protocolVersion,
+	}, true
+}
+
+// cachedTools returns the tools cached under key if they were discovered
+// from an MCP in the given state. The caller must hold the lock.
+func (m *MCPManager) cachedTools(key string, state toolCacheEntry) (mcpDiscovery, bool) {
+	entry, ok := m.toolCache.entries[key]
+	if !ok || !entry.sameState(state) {
+		return mcpDiscovery{}, false
+	}
+	return entry.mcpDiscovery, true
+}
+
+// cacheTools records the outcome of discovering the tools of the MCP whose
+// cache entry is key from an MCP in the given state. The caller must hold
+// the write lock.
+func (m *MCPManager) cacheTools(key string, state toolCacheEntry, discovery mcpDiscovery, err error) {
+	if err != nil {
+		// Don't keep serving tools from an MCP that no longer works
+		if _, ok := m.toolCache.entries[key]; ok {
+			delete(m.toolCache.entries, key)
+			m.toolCache.dirty = true
+		}
+		return
+	}
+
+	state.mcpDiscovery = discovery
+	m.toolCache.entries[key] = state
+	m.toolCache.dirty = true
+}
+
+// sameState reports whether two entries were made from an MCP in the same
+// state, whatever tools they hold
+func (e toolCacheEntry) sameState(other toolCacheEntry) bool {
+	return e.Version == other.Version &&
+		e.ModTime.Equal(other.ModTime) &&
+		e.Size == other.Size &&
+		string(e.Config) == string(other.Config) &&
+		sameFileStates(e.ArgFiles, other.ArgFiles) &&
+		slices.Equal(e.Launcher, other.Launcher) &&
+		e.RequestedVersion == other.RequestedVersion
+}
+
+// forgetCachedTools drops the cache entry of the MCP at mcpPath so its
+// tools are discovered afresh. The caller must hold the write lock.
+func (m *MCPManager) forgetCachedTools(mcpPath string, config MCPConfig) {
+	if m.toolCache == nil {
+		return
+	}
+	if key, err := toolCacheKey(mcpPath, config); err == nil {
+		if _, ok := m.toolCache.entries[key]; ok {
+			delete(m.toolCache.entries, key)
+			m.toolCache.dirty = true
+		}
+	}
+}
+
+// toolCacheKey returns the key of the cache entry of the MCP at mcpPath:
+// its absolute path, followed by its extra arguments, since MCPs listed in
+// a manifest may share an executable such as an interpreter
+func toolCacheKey(mcpPath string, config MCPConfig) (string, error) {
+	key, err := filepath.Abs(mcpPath)
+	if err != nil {
+		return "", err
+	}
+	if len(config.Args) > 0 {
+		key += " " + strings.Join(config.Args, " ")
+	}
+	return key, nil
+}
+
+// argFileStates returns the state of each regular file named in the
+// arguments of the MCP at mcpPath, keyed by argument. Relative paths are
+// resolved against the directory the MCP runs in.
+func argFileStates(mcpPath string, config MCPConfig) map[string]fileState {
+	var states map[string]fileState
+	dir := mcpWorkingDir(mcpPath, config)
+	for _, arg := range config.Args {
+		path := arg
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		if states == nil {
+			states = make(map[string]fileState)
+		}
+		states[arg] = fileState{ModTime: info.ModTime(), Size: info.Size()}
+	}
+	return states
+}
+
+// sameFileStates reports whether two sets of file states match
+func sameFileStates(a, b map[string]fileState) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for arg, state := range a {
+		other, ok := b[arg]
+		if !ok || !other.ModTime.Equal(state.ModTime) || other.Size != state.Size {
+			return false
+		}
+	}
+	return true
+}
+
+// saveToolCache writes the cache to disk if it changed. Failures are only
+// logged, since the cache is an optimization. The caller must hold the
+// write lock.
+func (m *MCPManager) saveToolCache() {
+	if m.toolCache == nil || !m.toolCache.dirty {
+		return
+	}
+
+	if err := m.toolCache.save(); err != nil {
+		m.logf("warning", "Warning: Failed to save tool cache: %v\n", err)
+		return
+	}
+	m.toolCache.dirty = false
+}
+
+// save atomically replaces the cache file with the current entries
+func (c *toolCache) save() error {
+	data, err := json.Marshal(c.entries)
+	if err != nil {
+		return fmt.Errorf("failed to marshal tool cache: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), ".tools-*.json")
+	if err != nil {
+		return fmt.Errorf("failed to create cache file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write cache file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write cache file: %w", err)
+	}
+
+	return os.Rename(tmp.Name(), c.path)
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+)
+
+// inflightRequest is a request that can be cancelled by its id
+type inflightRequest struct {
+	cancel context.CancelFunc
+}
+
+// requestKey returns the key an in-flight request is tracked under, its id
+// as compact JSON
+func requestKey(id json.RawMessage) string {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, id); err != nil {
+		return string(id)
+	}
+	return buf.String()
+}
+
+// trackRequest makes the request with the given id cancellable through
+// notifications/cancelled, returning the context to run it with and a
+// function to call once it has finished
+func (s *MCPServer) trackRequest(ctx context.Context, id json.RawMessage) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	request := &inflightRequest{cancel: cancel}
+	key := requestKey(id)
+
+	s.inflightMutex.Lock()
+	if s.inflight == nil {
+		s.inflight = make(map[string]*inflightRequest)
+	}
+	s.inflight[key] = request
+	s.inflightMutex.Unlock()
+
+	return ctx, func() {
+		s.inflightMutex.Lock()
+		// A later request may have reused the id
+		if s.inflight[key] == request {
+			delete(s.inflight, key)
+		}
+		s.inflightMutex.Unlock()
+		cancel()
+	}
+}
+
+// handleCancelled handles a notifications/cancelled notification by
+// cancelling the in-flight request it names. Requests that have already
+// finished, or were never seen, are ignored.
+func (s *MCPServer) handleCancelled(rawRequest []byte) {
+	var notification struct {
+		Params struct {
+			RequestID json.RawMessage `json:"requestId"`
+			Reason    string          `json:"reason"`
+		} `json:"params"`
+	}
+	if err := json.Unmarshal(rawRequest, &notification); err != nil || isNotification(notification.Params.RequestID) {
+		return
+	}
+
+	key := requestKey(notification.Params.RequestID)
+	s.inflightMutex.Lock()
+	request := s.inflight[key]
+	delete(s.inflight, key)
+	s.inflightMutex.Unlock()
+
+	if request == nil {
+		return
+	}
+	if notification.Params.Reason != "" {
+		s.logf("info", "Cancelling request %s: %s\n", key, notification.Params.Reason)
+	} else {
+		s.logf("info", "Cancelling request %s\n", key)
+	}
+	request.cancel()
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// SetCoalescing enables sharing one execution between concurrent calls of
+// the same tool with identical arguments. It should only be enabled when
+// the served tools are idempotent.
+func (m *MCPManager) SetCoalescing(enabled bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.coalesce = enabled
+}
+
+// coalescing reports whether identical concurrent calls are coalesced
+func (m *MCPManager) coalescing() bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.coalesce
+}
+
+// callKey identifies a tool call by the tool and its arguments.
+// Marshaling sorts map keys, so equal arguments give equal keys.
+func callKey(toolName string, parameters map[string]interface{}) (string, bool) {
+	arguments, err := json.Marshal(parameters)
+	if err != nil {
+		return "", false
+	}
+	sum := sha256.Sum256(append([]byte(toolName+"\x00"), arguments...))
+	return hex.EncodeToString(sum[:]), true
+}
+
+// executeShared runs execute once for all concurrent calls with the same
+// key. The execution is detached from the cancellation of the caller that
+// started it, so the others don't fail with it, but keeps its deadline;
+// each caller still stops waiting once its own ctx is done.
+func (m *MCPManager) executeShared(ctx context.Context, key string, execute func(ctx context.Context) (*CallToolResult, error)) (*CallToolResult, error) {
+	results := m.flights.DoChan(key, func() (interface{}, error) {
+		shared := context.WithoutCancel(ctx)
+		if deadline, ok := ctx.Deadline(); ok {
+			var cancel context.CancelFunc
+			shared, cancel = context.WithDeadline(shared, deadline)
+			defer cancel()
+		}
+		return execute(shared)
+	})
+
+	select {
+	case result := <-results:
+		if result.Err != nil {
+			return nil, result.Err
+		}
+		return result.Val.(*CallToolResult), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
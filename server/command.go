@@ -0,0 +1,67 @@
+package server
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+)
+
+// newMCPCommand builds the command that runs the MCP at mcpPath, through its
+// interpreter or configured command where needed. The subprocess runs in the
+// configured working directory, resolved against the MCP's directory when
+// relative, or in that directory by default so MCPs can find files next to
+// them, with the configured environment variables. A symlinked MCP runs next
+// to the file it points to. It fails if the configured user or group cannot
+// be used, or if resource limits are configured where they are unsupported.
+func newMCPCommand(mcpPath string, config MCPConfig) (*exec.Cmd, error) {
+	args, err := launchArgs(mcpPath, config)
+	if err != nil {
+		return nil, err
+	}
+	args, err = limitedArgs(args, config.Limits)
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Dir = mcpWorkingDir(mcpPath, config)
+	cmd.Env = mcpEnv(config)
+
+	if err := setCredential(cmd, config); err != nil {
+		return nil, err
+	}
+
+	return cmd, nil
+}
+
+// mcpWorkingDir returns the directory the MCP at mcpPath runs in
+func mcpWorkingDir(mcpPath string, config MCPConfig) string {
+	dir := filepath.Dir(resolveExecutable(mcpPath))
+	if config.WorkingDir != "" {
+		if filepath.IsAbs(config.WorkingDir) {
+			return config.WorkingDir
+		}
+		return filepath.Join(dir, config.WorkingDir)
+	}
+	return dir
+}
+
+// mcpEnv returns the environment of the subprocess: the server's own with
+// the configured variables added, or nil to inherit it unchanged
+func mcpEnv(config MCPConfig) []string {
+	if len(config.Env) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(config.Env))
+	for name := range config.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	env := os.Environ()
+	for _, name := range names {
+		env = append(env, name+"="+config.Env[name])
+	}
+	return env
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// errUnsupportedEncoding is returned for request bodies in a content coding
+// other than gzip
+var errUnsupportedEncoding = errors.New("unsupported content encoding")
+
+// decodeRequestBody replaces the body of r with its decompressed form when
+// it is gzipped. It must run before any size limit is applied, so the limit
+// counts decompressed bytes.
+func decodeRequestBody(r *http.Request) error {
+	switch strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))) {
+	case "", "identity":
+		return nil
+	case "gzip", "x-gzip":
+		reader, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return err
+		}
+		r.Body = &gzipBody{Reader: reader, body: r.Body}
+		r.Header.Del("Content-Encoding")
+		r.ContentLength = -1
+		return nil
+	default:
+		return errUnsupportedEncoding
+	}
+}
+
+// gzipBody decompresses a request body, closing the original body with it
+type gzipBody struct {
+	*gzip.Reader
+	body io.Closer
+}
+
+// Close implements io.Closer
+func (g *gzipBody) Close() error {
+	return errors.Join(g.Reader.Close(), g.body.Close())
+}
+
+// acceptsGzip reports whether the request's Accept-Encoding header allows a
+// gzipped response
+func acceptsGzip(r *http.Request) bool {
+	for _, value := range r.Header.Values("Accept-Encoding") {
+		for _, coding := range strings.Split(value, ",") {
+			name, params, _ := strings.Cut(coding, ";")
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name != "gzip" && name != "x-gzip" {
+				continue
+			}
+			// A weight of zero explicitly refuses the coding
+			if weight, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok && weightIsZero(weight) {
+				return false
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// weightIsZero reports whether q, the weight of a content negotiation
+// header entry, is zero, which refuses what the entry names
+func weightIsZero(q string) bool {
+	weight, err := strconv.ParseFloat(strings.TrimSpace(q), 64)
+	return err == nil && weight == 0
+}
+
+// writeJSON writes a JSON response body in the content type the request
+// asks for, gzipped when the client accepts it
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, body []byte) {
+	w.Header().Set("Content-Type", responseContentType(r))
+	w.Header().Add("Vary", "Accept, Accept-Encoding")
+	if !acceptsGzip(r) {
+		w.WriteHeader(status)
+		w.Write(body)
+		return
+	}
+
+	w.Header().Set("Content-Encoding", "gzip")
+	w.WriteHeader(status)
+	writer := gzip.NewWriter(w)
+	writer.Write(body)
+	writer.Close()
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// defaultContentType is the content type of JSON-RPC responses to requests
+// that don't ask for another JSON media type
+const defaultContentType = "application/json"
+
+// responseContentType returns the content type to answer r with: the first
+// JSON media type its Accept header lists, else the media type of its body
+// if that is JSON, else application/json. Parameters such as charset are
+// dropped, since responses are always UTF-8, and other media types are
+// ignored, since responses are always JSON.
+func responseContentType(r *http.Request) string {
+	for _, value := range r.Header.Values("Accept") {
+		for _, part := range strings.Split(value, ",") {
+			if contentType, ok := jsonMediaType(part); ok {
+				return contentType
+			}
+		}
+	}
+	if contentType, ok := jsonMediaType(r.Header.Get("Content-Type")); ok {
+		return contentType
+	}
+	return defaultContentType
+}
+
+// jsonMediaType parses value, a media type or Accept media range, returning
+// the media type without its parameters if it is a JSON media type that
+// isn't refused
+func jsonMediaType(value string) (string, bool) {
+	mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(value))
+	if err != nil || !isJSONMediaType(mediaType) {
+		return "", false
+	}
+	if q, ok := params["q"]; ok && weightIsZero(q) {
+		return "", false
+	}
+	return mediaType, true
+}
+
+// isJSONMediaType reports whether mediaType denotes a JSON body, such as
+// application/json, application/json-rpc or application/vnd.example+json
+func isJSONMediaType(mediaType string) bool {
+	subtype, ok := strings.CutPrefix(mediaType, "application/")
+	if !ok {
+		return false
+	}
+	return subtype == "json" || subtype == "json-rpc" || strings.HasSuffix(subtype, "+json")
+}
@@ -0,0 +1,22 @@
+//go:build !unix
+
+package server
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// checkCredential fails if a user or group is configured, since privileges
+// can only be dropped on Unix
+func checkCredential(config MCPConfig) error {
+	if config.RunAsUser != "" || config.RunAsGroup != "" {
+		return errors.New("runAsUser/runAsGroup is only supported on Unix")
+	}
+	return nil
+}
+
+// setCredential validates the configuration; there is nothing to apply
+func setCredential(cmd *exec.Cmd, config MCPConfig) error {
+	return checkCredential(config)
+}
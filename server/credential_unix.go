@@ -0,0 +1,110 @@
+//go:build unix
+
+package server
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// lookupCredential resolves the configured runAsUser and runAsGroup to the
+// credential the subprocess runs with, or nil if neither is set. Dropping
+// privileges requires the server to run as root.
+func lookupCredential(config MCPConfig) (*syscall.Credential, error) {
+	if config.RunAsUser == "" && config.RunAsGroup == "" {
+		return nil, nil
+	}
+
+	if os.Geteuid() != 0 {
+		return nil, fmt.Errorf("runAsUser/runAsGroup requires the server to run as root")
+	}
+
+	// Supplementary groups are always replaced, so the MCP doesn't keep
+	// those of the server
+	credential := &syscall.Credential{
+		Uid:    uint32(os.Getuid()),
+		Gid:    uint32(os.Getgid()),
+		Groups: []uint32{},
+	}
+
+	if config.RunAsUser != "" {
+		lookup := user.Lookup
+		if isNumericID(config.RunAsUser) {
+			lookup = user.LookupId
+		}
+		u, err := lookup(config.RunAsUser)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up user %q: %w", config.RunAsUser, err)
+		}
+		uid, err := strconv.ParseUint(u.Uid, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid uid for user %q: %w", config.RunAsUser, err)
+		}
+		gid, err := strconv.ParseUint(u.Gid, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gid for user %q: %w", config.RunAsUser, err)
+		}
+		credential.Uid = uint32(uid)
+		credential.Gid = uint32(gid)
+
+		groupIDs, err := u.GroupIds()
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up groups of user %q: %w", config.RunAsUser, err)
+		}
+		for _, id := range groupIDs {
+			groupID, err := strconv.ParseUint(id, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid group id %q of user %q: %w", id, config.RunAsUser, err)
+			}
+			credential.Groups = append(credential.Groups, uint32(groupID))
+		}
+	}
+
+	if config.RunAsGroup != "" {
+		lookup := user.LookupGroup
+		if isNumericID(config.RunAsGroup) {
+			lookup = user.LookupGroupId
+		}
+		g, err := lookup(config.RunAsGroup)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up group %q: %w", config.RunAsGroup, err)
+		}
+		gid, err := strconv.ParseUint(g.Gid, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gid for group %q: %w", config.RunAsGroup, err)
+		}
+		credential.Gid = uint32(gid)
+	}
+
+	return credential, nil
+}
+
+// isNumericID reports whether name is a numeric uid or gid
+func isNumericID(name string) bool {
+	_, err := strconv.ParseUint(name, 10, 32)
+	return err == nil
+}
+
+// checkCredential validates the configured user and group
+func checkCredential(config MCPConfig) error {
+	_, err := lookupCredential(config)
+	return err
+}
+
+// setCredential makes cmd run as the configured user and group, if any
+func setCredential(cmd *exec.Cmd, config MCPConfig) error {
+	credential, err := lookupCredential(config)
+	if err != nil || credential == nil {
+		return err
+	}
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Credential = credential
+	return nil
+}
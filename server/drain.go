@@ -0,0 +1,82 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// closeTimeout bounds how long Close waits for tool calls to finish and
+// subprocesses to exit
+const closeTimeout = 30 * time.Second
+
+// ErrDraining is returned for tool calls made after Drain has been called
+var ErrDraining = errors.New("server is shutting down")
+
+// activeCalls returns the number of tool calls in flight
+func (m *MCPManager) activeCalls() int64 {
+	return m.inFlight.Load()
+}
+
+// beginCall registers a tool call in flight, refusing it if the manager is
+// draining. The caller must call endCall once the call finishes.
+func (m *MCPManager) beginCall() error {
+	m.callsMutex.Lock()
+	defer m.callsMutex.Unlock()
+
+	if m.draining {
+		return ErrDraining
+	}
+	m.calls.Add(1)
+	m.inFlight.Add(1)
+	return nil
+}
+
+// Drain refuses new tool calls and waits for those in flight to finish or
+// ctx to expire. The subprocesses are left running for the caller to stop.
+func (m *MCPManager) Drain(ctx context.Context) error {
+	m.callsMutex.Lock()
+	m.draining = true
+	m.callsMutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		m.calls.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%d tool calls still in flight: %w", m.activeCalls(), ctx.Err())
+	}
+}
+
+// Drain stops accepting tool calls and waits for those in flight to finish
+// or ctx to expire before shutting down the HTTP servers and subprocesses
+func (s *MCPServer) Drain(ctx context.Context) error {
+	return errors.Join(s.mcpManager.Drain(ctx), s.Shutdown(ctx))
+}
+
+// Close releases everything the server holds: it stops the health checks
+// and idle reaper, drains in-flight tool calls, shuts down the HTTP, admin
+// and gRPC servers, and waits for the persistent MCP subprocesses to exit,
+// giving up after closeTimeout. Subsequent calls return the first result.
+func (s *MCPServer) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+
+		ctx, cancel := context.WithTimeout(context.Background(), closeTimeout)
+		defer cancel()
+		s.closeErr = errors.Join(s.Drain(ctx), s.mcpManager.waitForProcesses(ctx))
+	})
+	return s.closeErr
+}
+
+// endCall unregisters a tool call registered with beginCall
+func (m *MCPManager) endCall() {
+	m.inFlight.Add(-1)
+	m.calls.Done()
+}
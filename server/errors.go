@@ -0,0 +1,189 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// JSON-RPC error codes reported for failed tool calls, so clients can tell
+// failures apart without matching messages
+const (
+	// CodeToolNotFound is reported for calls of tools that don't exist or
+	// are filtered out
+	CodeToolNotFound = -32601
+	// CodeInvalidParams is reported for malformed arguments, whether the
+	// server or the MCP rejected them
+	CodeInvalidParams = -32602
+	// CodeToolFailed is reported for failures in no other category
+	CodeToolFailed = -32000
+	// CodeMCPExited is reported when the MCP subprocess exited or was
+	// killed before answering
+	CodeMCPExited = -32001
+	// CodeToolTimeout is reported when the call ran out of time
+	CodeToolTimeout = -32002
+	// CodeMCPUnavailable is reported when the MCP can't take calls: it is
+	// disabled, unhealthy, behind an open circuit breaker or the server is
+	// shutting down
+	CodeMCPUnavailable = -32003
+	// CodeMCPStartFailed is reported when the MCP subprocess couldn't be
+	// started at all
+	CodeMCPStartFailed = -32004
+	// CodeMCPProtocolError is reported when the MCP answered with a message
+	// that isn't valid MCP
+	CodeMCPProtocolError = -32005
+)
+
+var (
+	// ErrToolNotFound is returned for calls of tools no loaded MCP serves
+	ErrToolNotFound = errors.New("tool not found")
+	// ErrToolTimeout is returned for calls whose deadline passed before the
+	// MCP answered
+	ErrToolTimeout = errors.New("tool call timed out")
+	// ErrMCPExited is returned when an MCP subprocess exited before
+	// answering a call. ProcessExitError matches it with errors.Is.
+	ErrMCPExited = errors.New("MCP subprocess exited")
+	// ErrMCPUnavailable is returned for calls to an MCP that is disabled
+	// or unhealthy
+	ErrMCPUnavailable = errors.New("MCP unavailable")
+)
+
+// ToolError is an error an MCP reported in its response to a tool call
+type ToolError struct {
+	Code    int
+	Message string
+}
+
+// Error implements the error interface
+func (e *ToolError) Error() string {
+	return fmt.Sprintf("MCP tool error: %s (code %d)", e.Message, e.Code)
+}
+
+// ProcessExitError describes how an MCP subprocess ended when it exited
+// before answering a request
+type ProcessExitError struct {
+	// ExitCode is the exit status, or -1 if the subprocess was killed
+	ExitCode int
+	// Signal is the signal that killed the subprocess, if any
+	Signal os.Signal
+}
+
+// Error implements the error interface
+func (e *ProcessExitError) Error() string {
+	if e.Signal != nil {
+		return fmt.Sprintf("MCP subprocess killed by signal: %v", e.Signal)
+	}
+	return fmt.Sprintf("MCP subprocess exited with code %d", e.ExitCode)
+}
+
+// Is reports whether target is ErrMCPExited
+func (e *ProcessExitError) Is(target error) bool {
+	return target == ErrMCPExited
+}
+
+// StartError is returned when an MCP subprocess couldn't be started, which
+// points at a deployment problem such as a missing binary or interpreter,
+// or wrong permissions, rather than an MCP that misbehaves once running.
+// Err carries the underlying error, often an *exec.Error or *fs.PathError.
+type StartError struct {
+	Path string
+	Err  error
+}
+
+// Error implements the error interface
+func (e *StartError) Error() string {
+	return fmt.Sprintf("failed to start MCP %s: %v", e.Path, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *StartError) Unwrap() error {
+	return e.Err
+}
+
+// ProtocolError is returned when a running MCP answers with a message
+// that isn't valid MCP, which points at a bug in the MCP
+type ProtocolError struct {
+	Err error
+}
+
+// Error implements the error interface
+func (e *ProtocolError) Error() string {
+	return fmt.Sprintf("MCP protocol error: %v", e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *ProtocolError) Unwrap() error {
+	return e.Err
+}
+
+// newProcessExitError describes the outcome of a subprocess that has been
+// waited for
+func newProcessExitError(state *os.ProcessState) *ProcessExitError {
+	exitErr := &ProcessExitError{ExitCode: state.ExitCode()}
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		exitErr.Signal = status.Signal()
+	}
+	return exitErr
+}
+
+// toolCallErrorCode returns the JSON-RPC error code reporting that a tool
+// call failed with err
+func toolCallErrorCode(err error) int {
+	var toolErr *ToolError
+	var startErr *StartError
+	var protocolErr *ProtocolError
+	switch {
+	case errors.Is(err, ErrToolNotFound), errors.Is(err, ErrToolDenied):
+		return CodeToolNotFound
+	case errors.Is(err, ErrToolTimeout):
+		return CodeToolTimeout
+	case errors.Is(err, ErrMCPExited):
+		return CodeMCPExited
+	case errors.Is(err, ErrMCPUnavailable), errors.Is(err, ErrCircuitOpen), errors.Is(err, ErrDraining):
+		return CodeMCPUnavailable
+	case errors.As(err, &startErr):
+		return CodeMCPStartFailed
+	case errors.As(err, &protocolErr):
+		return CodeMCPProtocolError
+	case errors.As(err, &toolErr) && (toolErr.Code == CodeToolNotFound || toolErr.Code == CodeInvalidParams):
+		// The MCP doesn't know the tool or rejected its arguments
+		return toolErr.Code
+	default:
+		return CodeToolFailed
+	}
+}
+
+// clientError returns the message to show a client for err. When error
+// masking is enabled the details are logged under a random reference and
+// only the reference is returned, so operators can correlate a
+// client-reported error without exposing internals.
+func (s *MCPServer) clientError(prefix string, err error) string {
+	if !s.maskErrors {
+		return fmt.Sprintf("%s: %v", prefix, err)
+	}
+
+	ref := newErrorRef()
+	s.logf("error", "Error ref %s: %s: %v\n", ref, prefix, err)
+	return fmt.Sprintf("internal error, ref %s", ref)
+}
+
+// newErrorRef returns a short random reference for a masked error
+func newErrorRef() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(buf)
+}
+
+// maskedError returns err, or a generic error carrying its reference when
+// error masking is enabled
+func (s *MCPServer) maskedError(prefix string, err error) error {
+	if !s.maskErrors {
+		return fmt.Errorf("%s: %w", prefix, err)
+	}
+	return errors.New(s.clientError(prefix, err))
+}
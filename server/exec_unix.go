@@ -0,0 +1,19 @@
+//go:build !windows
+
+package server
+
+import (
+	"io/fs"
+	"os/exec"
+)
+
+// isExecutable reports whether the file at path can be run directly, based
+// on its executable bits
+func isExecutable(path string, info fs.FileInfo) bool {
+	return info.Mode()&0111 != 0
+}
+
+// killProcess kills the started subprocess of cmd
+func killProcess(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
@@ -0,0 +1,46 @@
+//go:build windows
+
+package server
+
+import (
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// defaultPathExt is used when PATHEXT is not set
+const defaultPathExt = ".COM;.EXE;.BAT;.CMD"
+
+// isExecutable reports whether the file at path can be run directly.
+// Windows has no executable bit, so this keys off the extensions listed in
+// PATHEXT.
+func isExecutable(path string, info fs.FileInfo) bool {
+	pathExt := os.Getenv("PATHEXT")
+	if pathExt == "" {
+		pathExt = defaultPathExt
+	}
+
+	ext := filepath.Ext(path)
+	if ext == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(pathExt, ";") {
+		if strings.EqualFold(ext, candidate) {
+			return true
+		}
+	}
+	return false
+}
+
+// killProcess kills the started subprocess of cmd together with its
+// children. Process.Kill only terminates the immediate process, which for
+// .bat and .cmd MCPs is the cmd.exe running the script.
+func killProcess(cmd *exec.Cmd) {
+	kill := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid))
+	if err := kill.Run(); err != nil {
+		cmd.Process.Kill()
+	}
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"path"
+)
+
+// ErrToolDenied is returned for calls to tools excluded by the allow and
+// deny patterns
+var ErrToolDenied = errors.New("tool not available")
+
+// SetToolFilter restricts the tools that are listed and callable. Patterns
+// are globs matched against the namespaced tool name (e.g. "calculator.*").
+// When allow is non-empty a tool must match one of its patterns, and a tool
+// matching any deny pattern is always excluded.
+func (m *MCPManager) SetToolFilter(allow, deny []string) error {
+	for _, pattern := range append(append([]string{}, allow...), deny...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid tool pattern %q: %w", pattern, err)
+		}
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.allowPatterns = append([]string{}, allow...)
+	m.denyPatterns = append([]string{}, deny...)
+	return nil
+}
+
+// toolAllowed reports whether the namespaced tool passes the allow and deny
+// patterns. The caller must hold the lock.
+func (m *MCPManager) toolAllowed(toolName string) bool {
+	if len(m.allowPatterns) > 0 && !matchesAny(m.allowPatterns, toolName) {
+		return false
+	}
+	return !matchesAny(m.denyPatterns, toolName)
+}
+
+// matchesAny reports whether name matches any of the validated patterns
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Framings of the JSON-RPC messages written to an MCP, configured by the
+// framing setting of its manifest. Messages from the MCP may use either.
+const (
+	// FramingNewline writes one message per line, the default
+	FramingNewline = "newline"
+	// FramingContentLength precedes each message with LSP-style
+	// Content-Length headers
+	FramingContentLength = "content-length"
+)
+
+// contentLengthHeader is the header giving the size of a framed message
+const contentLengthHeader = "content-length"
+
+// validFraming reports whether framing is a supported framing setting
+func validFraming(framing string) bool {
+	switch framing {
+	case "", FramingNewline, FramingContentLength:
+		return true
+	}
+	return false
+}
+
+// readFramedMessage reads the next message from reader, which may be a line
+// of newline-delimited JSON or a message framed by Content-Length headers.
+// The framing is detected per message from its first line, so blank lines
+// between messages are skipped. Neither a line nor a framed message may be
+// larger than maxSize.
+func readFramedMessage(reader *bufio.Reader, maxSize int) ([]byte, error) {
+	for {
+		line, err := readLine(reader, maxSize)
+		trimmed := bytes.TrimSpace(line)
+		if len(trimmed) == 0 {
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if trimmed[0] == '{' || trimmed[0] == '[' || !isHeaderLine(trimmed, contentLengthHeader) {
+			return trimmed, err
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return readFramedBody(reader, trimmed, maxSize)
+	}
+}
+
+// readFramedBody reads the rest of the headers of a framed message, whose
+// first header line has been read, and then its body
+func readFramedBody(reader *bufio.Reader, firstHeader []byte, maxSize int) ([]byte, error) {
+	length := -1
+	header := firstHeader
+	for len(header) > 0 {
+		name, value, _ := strings.Cut(string(header), ":")
+		if strings.EqualFold(strings.TrimSpace(name), contentLengthHeader) {
+			n, err := strconv.Atoi(strings.TrimSpace(value))
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid Content-Length header %q", header)
+			}
+			length = n
+		}
+
+		line, err := readLine(reader, maxSize)
+		if err != nil {
+			return nil, err
+		}
+		header = bytes.TrimSpace(line)
+	}
+
+	if length > maxSize {
+		return nil, &ProtocolError{Err: fmt.Errorf("%w (%d bytes)", errMCPMessageTooLarge, maxSize)}
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(reader, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// isHeaderLine reports whether line is a header with the given name
+func isHeaderLine(line []byte, name string) bool {
+	key, _, ok := bytes.Cut(line, []byte(":"))
+	return ok && strings.EqualFold(string(bytes.TrimSpace(key)), name)
+}
+
+// frameMessage returns message ready to write in the given framing
+func frameMessage(message []byte, contentLength bool) []byte {
+	if contentLength {
+		header := fmt.Sprintf("Content-Length: %d\r\n\r\n", len(message))
+		return append([]byte(header), message...)
+	}
+	return append(message, '\n')
+}
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"strings"
+)
+
+// groupFor returns the group of the MCP at path. A group set in the manifest
+// wins; otherwise an MCP inside a subdirectory of an MCP directory belongs
+// to the group named after the top-level subdirectory. MCPs outside the
+// directories, such as those listed in a manifest, only have a group if their
+// configuration sets one.
+func (m *MCPManager) groupFor(path string, config MCPConfig) string {
+	if config.Group != "" {
+		return config.Group
+	}
+
+	root, ok := m.mcpRoot(path)
+	if !ok {
+		return ""
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return ""
+	}
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	if len(parts) < 2 || parts[0] == ".." {
+		return ""
+	}
+	return parts[0]
+}
+
+// isEnabled reports whether the tools of mcpInfo are served.
+// The caller must hold the lock.
+func (m *MCPManager) isEnabled(mcpInfo *MCPInfo) bool {
+	return !m.disabledGroups[mcpInfo.Group] && !m.disabledMCPs[mcpInfo.Name]
+}
+
+// GetGroupTools returns the tools of the enabled MCPs in group, sorted by name
+func (m *MCPManager) GetGroupTools(group string) []ToolInfo {
+	return m.collectTools(func(mcpInfo *MCPInfo) bool {
+		return mcpInfo.Group == group
+	})
+}
+
+// SetGroupEnabled enables or disables serving the tools of every MCP in group
+func (m *MCPManager) SetGroupEnabled(group string, enabled bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if enabled {
+		delete(m.disabledGroups, group)
+	} else {
+		m.disabledGroups[group] = true
+	}
+}
+
+// SetMCPEnabled enables or disables serving the tools of a single MCP. The
+// setting survives reloads of the MCP.
+func (m *MCPManager) SetMCPEnabled(name string, enabled bool) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.mcpMap[name]; !ok {
+		return fmt.Errorf("MCP not found: %s", name)
+	}
+
+	if enabled {
+		delete(m.disabledMCPs, name)
+	} else {
+		m.disabledMCPs[name] = true
+	}
+	return nil
+}
+
+// ReloadGroup re-reads the manifest and rediscovers the tools of every
+// loaded MCP in group, leaving other MCPs untouched. The group's MCPs keep
+// serving calls while their tools are rediscovered, and keep their previous
+// state if ctx is done first.
+func (m *MCPManager) ReloadGroup(ctx context.Context, group string) error {
+	m.loadMutex.Lock()
+	defer m.loadMutex.Unlock()
+
+	m.mutex.Lock()
+	var members []*MCPInfo
+	for _, mcpInfo := range m.mcpMap {
+		if mcpInfo.Group == group {
+			members = append(members, mcpInfo)
+		}
+	}
+	if len(members) == 0 {
+		m.mutex.Unlock()
+		return fmt.Errorf("no MCPs in group: %s", group)
+	}
+
+	// Reload the members into a copy of the state, keeping the current one
+	// in place until their tools are discovered
+	previous := m.swapLoadState(loadState{
+		mcpMap:        maps.Clone(m.mcpMap),
+		loadErrors:    m.loadErrors,
+		listedConfigs: m.listedConfigs,
+	})
+	for _, member := range members {
+		m.clearLoadErrors(member.Path)
+		m.forgetCachedTools(member.Path, member.Config)
+		delete(m.mcpMap, member.Name)
+		if mcpInfo := m.loadMCP(member.Name, member.Path); mcpInfo != nil {
+			m.mcpMap[member.Name] = mcpInfo
+		}
+	}
+	staged := m.swapLoadState(previous)
+	pending, protocolVersion, timeout := m.takeDiscoveries()
+	m.mutex.Unlock()
+
+	m.discoverPending(ctx, pending, protocolVersion, timeout)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.swapLoadState(staged)
+	for _, p := range pending {
+		m.finishDiscovery(p)
+	}
+	m.checkAliasesLocked()
+	m.saveToolCache()
+	return nil
+}
+
+// clearLoadErrors drops recorded load errors for the MCP at path. The
+// errors are copied rather than filtered in place, so an abandoned reload
+// can keep the previous ones. The caller must hold the write lock.
+func (m *MCPManager) clearLoadErrors(path string) {
+	var loadErrors []LoadError
+	for _, loadError := range m.loadErrors {
+		if loadError.Path != path {
+			loadErrors = append(loadErrors, loadError)
+		}
+	}
+	m.loadErrors = loadErrors
+}
@@ -0,0 +1,197 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/mcp-net/mcp-proxy/mcppb"
+)
+
+// grpcService serves the loaded tools through the gRPC MCPService
+type grpcService struct {
+	mcppb.UnimplementedMCPServiceServer
+	server *MCPServer
+}
+
+// ServeGRPC serves the loaded tools over gRPC, as the MCPService defined in
+// mcppb/mcp.proto
+func (s *MCPServer) ServeGRPC(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.ServeGRPCListener(ln)
+}
+
+// ServeGRPCListener serves the loaded tools over gRPC on an existing
+// listener. It returns nil once the server is shut down.
+func (s *MCPServer) ServeGRPCListener(ln net.Listener) error {
+	var opts []grpc.ServerOption
+	if s.maxRequestBytes > 0 {
+		opts = append(opts, grpc.MaxRecvMsgSize(int(s.maxRequestBytes)))
+	}
+	server := grpc.NewServer(opts...)
+	mcppb.RegisterMCPServiceServer(server, &grpcService{server: s})
+
+	s.httpMutex.Lock()
+	s.grpcServer = server
+	s.httpMutex.Unlock()
+
+	s.logf("info", "MCP gRPC Server listening on %s\n", ln.Addr())
+	return server.Serve(ln)
+}
+
+// stopGRPC stops the gRPC server, if running, letting in-flight calls
+// finish until ctx is done
+func (s *MCPServer) stopGRPC(ctx context.Context) error {
+	s.httpMutex.Lock()
+	server := s.grpcServer
+	s.httpMutex.Unlock()
+	if server == nil {
+		return nil
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		server.Stop()
+		return ctx.Err()
+	}
+}
+
+// ListTools implements mcppb.MCPServiceServer
+func (g *grpcService) ListTools(ctx context.Context, request *mcppb.ListToolsRequest) (*mcppb.ListToolsResponse, error) {
+	tools := g.server.mcpManager.GetAllTools()
+
+	response := &mcppb.ListToolsResponse{Tools: make([]*mcppb.Tool, 0, len(tools))}
+	for _, tool := range tools {
+		schema := tool.Parameters
+		if schema == nil {
+			schema = defaultInputSchema()
+		}
+		inputSchema, err := toStruct(schema)
+		if err != nil {
+			g.server.logf("warning", "Warning: Failed to convert input schema for %s: %v\n", tool.Name, err)
+			continue
+		}
+		response.Tools = append(response.Tools, &mcppb.Tool{
+			Name:        tool.Name,
+			Description: tool.Description,
+			InputSchema: inputSchema,
+		})
+	}
+	return response, nil
+}
+
+// CallTool implements mcppb.MCPServiceServer
+func (g *grpcService) CallTool(ctx context.Context, request *mcppb.CallToolRequest) (*mcppb.CallToolResponse, error) {
+	s := g.server
+	arguments := request.GetArguments().AsMap()
+
+	// Apply the same argument limits as the JSON-RPC transports
+	raw, err := json.Marshal(arguments)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Invalid arguments: %v", err)
+	}
+	if err := checkJSONComplexity(raw, s.maxArgumentDepth, s.maxArgumentElements); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Invalid arguments: %v", err)
+	}
+
+	s.mcpManager.logPayload("gRPC request to call %s: %s\n", arguments, request.GetName())
+
+	result, err := s.mcpManager.ExecuteTool(ctx, request.GetName(), arguments, nil)
+	if err != nil {
+		// Filtered tools look as if they don't exist
+		if errors.Is(err, ErrToolDenied) {
+			return nil, status.Errorf(codes.NotFound, "Tool not found: %s", request.GetName())
+		}
+		return nil, status.Error(grpcCode(err), s.clientError("Failed to execute tool", err))
+	}
+
+	response, err := toCallToolResponse(truncateResult(result, s.maxResultBytes))
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to convert tool result: %v", err)
+	}
+	return response, nil
+}
+
+// grpcCode returns the gRPC status code reporting that a tool call failed
+// with err
+func grpcCode(err error) codes.Code {
+	if errors.Is(err, context.Canceled) {
+		return codes.Canceled
+	}
+	switch toolCallErrorCode(err) {
+	case CodeToolNotFound:
+		return codes.NotFound
+	case CodeInvalidParams:
+		return codes.InvalidArgument
+	case CodeToolTimeout:
+		return codes.DeadlineExceeded
+	case CodeMCPExited, CodeMCPUnavailable:
+		return codes.Unavailable
+	case CodeMCPStartFailed:
+		return codes.FailedPrecondition
+	case CodeMCPProtocolError:
+		return codes.Internal
+	default:
+		return codes.Unknown
+	}
+}
+
+// toCallToolResponse converts a tool result to its gRPC representation
+func toCallToolResponse(result *CallToolResult) (*mcppb.CallToolResponse, error) {
+	raw, err := toStruct(result)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &mcppb.CallToolResponse{
+		Content: make([]*mcppb.Content, 0, len(result.Content)),
+		IsError: result.IsError,
+		Raw:     raw,
+	}
+	for _, content := range result.Content {
+		block := &mcppb.Content{
+			Type:     content.Type,
+			Text:     content.Text,
+			Data:     content.Data,
+			MimeType: content.MimeType,
+		}
+		if content.Resource != nil {
+			if block.Resource, err = toStruct(content.Resource); err != nil {
+				return nil, err
+			}
+		}
+		response.Content = append(response.Content, block)
+	}
+	return response, nil
+}
+
+// toStruct converts v, which must encode as a JSON object, to a Struct
+func toStruct(v interface{}) (*structpb.Struct, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("not a JSON object: %w", err)
+	}
+	return structpb.NewStruct(fields)
+}
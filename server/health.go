@@ -0,0 +1,101 @@
+package server
+
+import (
+	"context"
+	"reflect"
+	"time"
+)
+
+// MCP health states reported in the server inventory
+const (
+	MCPHealthHealthy   = "healthy"
+	MCPHealthUnhealthy = "unhealthy"
+)
+
+// CheckHealth re-queries every MCP for its tool list. MCPs that fail to
+// respond are marked unhealthy and their tools are withheld until a later
+// check succeeds, at which point their tool list is refreshed. It reports
+// whether any MCP's health or tools changed. Running persistent subprocesses are
+// pinged as well, and restarted on their next call if they don't answer or
+// have outlived their maximum lifetime.
+// Checks cut short because ctx is done leave the MCPs' health unchanged.
+func (m *MCPManager) CheckHealth(ctx context.Context) bool {
+	m.recycleExpiredProcesses()
+	m.pingProcesses()
+
+	// Snapshot the MCPs so the slow checks run without holding the lock
+	m.mutex.RLock()
+	mcpInfos := make([]*MCPInfo, 0, len(m.mcpMap))
+	for _, mcpInfo := range m.mcpMap {
+		mcpInfos = append(mcpInfos, mcpInfo)
+	}
+	m.mutex.RUnlock()
+
+	changed := false
+	for _, mcpInfo := range mcpInfos {
+		discovery, err := m.getToolInfos(ctx, m.requestedProtocolVersion(), m.currentDiscoveryTimeout(), mcpInfo.Path, mcpInfo.Config)
+		if ctx.Err() != nil {
+			break
+		}
+
+		m.mutex.Lock()
+		// Skip MCPs replaced by a reload while they were being checked
+		if m.mcpMap[mcpInfo.Name] != mcpInfo {
+			m.mutex.Unlock()
+			continue
+		}
+
+		health := MCPHealthHealthy
+		if err != nil {
+			health = MCPHealthUnhealthy
+		} else {
+			// Clients must learn of tools added, removed or redefined by an
+			// MCP that stayed healthy too
+			if !reflect.DeepEqual(mcpInfo.ToolInfos, discovery.Tools) {
+				changed = true
+				if mcpInfo.Health == MCPHealthHealthy {
+					m.logf("info", "MCP %s now has %d tools\n", mcpInfo.Name, len(discovery.Tools))
+				}
+			}
+			// An MCP that failed to load counts as loaded once it answers
+			mcpInfo.setDiscovery(discovery)
+			mcpInfo.Status = MCPStatusLoaded
+		}
+
+		if health != mcpInfo.Health {
+			changed = true
+			if err != nil {
+				m.logf("warning", "Warning: MCP %s is unhealthy: %v\n", mcpInfo.Name, err)
+			} else {
+				m.logf("info", "MCP %s is healthy again with %d tools\n", mcpInfo.Name, len(discovery.Tools))
+			}
+			mcpInfo.Health = health
+		}
+		m.mutex.Unlock()
+	}
+
+	return changed
+}
+
+// StartHealthChecks checks the health of every MCP each interval until ctx
+// is done or the server is closed, updating the tools served to clients
+// whenever health or tools change
+func (s *MCPServer) StartHealthChecks(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-s.closed:
+				return
+			case <-ticker.C:
+				if s.mcpManager.CheckHealth(ctx) {
+					s.registerMCPTools()
+				}
+			}
+		}
+	}()
+}
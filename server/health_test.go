@@ -0,0 +1,38 @@
+package server
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCheckHealthToolChanges(t *testing.T) {
+	// While extended is set, the MCP lists a second tool
+	var extended atomic.Bool
+	s := newFakeServer(t, serveRPC(func(message rpcMessage) map[string]interface{} {
+		if message.Method == "tools/list" && extended.Load() {
+			reply := echoToolsReply()
+			tools := reply["result"].(map[string]interface{})["tools"].([]map[string]interface{})
+			reply["result"].(map[string]interface{})["tools"] = append(tools, map[string]interface{}{"name": "shout"})
+			return reply
+		}
+		return echoMCP(message)
+	}))
+
+	if s.mcpManager.CheckHealth(context.Background()) {
+		t.Fatal("CheckHealth reported a change with the same tools")
+	}
+
+	extended.Store(true)
+	if !s.mcpManager.CheckHealth(context.Background()) {
+		t.Fatal("CheckHealth reported no change after a tool was added")
+	}
+	if tools := s.mcpManager.GetAllTools(); len(tools) != 2 {
+		t.Fatalf("tools = %+v, want echo.say and echo.shout", tools)
+	}
+
+	extended.Store(false)
+	if !s.mcpManager.CheckHealth(context.Background()) {
+		t.Fatal("CheckHealth reported no change after a tool was removed")
+	}
+}
@@ -0,0 +1,192 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// launcherPathPlaceholder stands for the script's path in a launcher
+// command template
+const launcherPathPlaceholder = "{path}"
+
+// defaultLaunchers maps the extensions of script MCPs to the command
+// template that runs them when the script itself isn't executable
+var defaultLaunchers = map[string][]string{
+	".py": {"python3", launcherPathPlaceholder},
+	".js": {"node", launcherPathPlaceholder},
+	".rb": {"ruby", launcherPathPlaceholder},
+	".pl": {"perl", launcherPathPlaceholder},
+	".sh": {"sh", launcherPathPlaceholder},
+}
+
+// SetLaunchers registers the commands that run script MCPs, keyed by file
+// extension including the dot (e.g. ".py"), on top of the defaults. Each
+// command is a template in which "{path}" is replaced by the script's path;
+// a template without it gets the path appended. An empty command removes
+// the launcher for its extension. Changes apply on the next load.
+func (m *MCPManager) SetLaunchers(launchers map[string][]string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.launchers = make(map[string][]string, len(defaultLaunchers)+len(launchers))
+	for ext, command := range defaultLaunchers {
+		m.launchers[ext] = command
+	}
+	for ext, command := range launchers {
+		if len(command) == 0 {
+			delete(m.launchers, ext)
+			continue
+		}
+		m.launchers[ext] = append([]string{}, command...)
+	}
+}
+
+// launcherForLocked returns the command template registered for the
+// extension of the file at path, or nil if there is none. The caller must
+// hold the lock.
+func (m *MCPManager) launcherForLocked(path string) []string {
+	return m.launchers[filepath.Ext(resolveExecutable(path))]
+}
+
+// expandLauncher returns the command line that runs the script at path
+// under the launcher template
+func expandLauncher(template []string, path string) []string {
+	args := make([]string, 0, len(template)+1)
+	expanded := false
+	for _, arg := range template {
+		if strings.Contains(arg, launcherPathPlaceholder) {
+			arg = strings.ReplaceAll(arg, launcherPathPlaceholder, path)
+			expanded = true
+		}
+		args = append(args, arg)
+	}
+	if !expanded {
+		args = append(args, path)
+	}
+	return args
+}
+
+// errNoLauncher is returned for files that are neither executable nor have
+// a known way to run them
+var errNoLauncher = errors.New("not executable and no interpreter is known for it")
+
+// launchArgs returns the command line that runs the MCP at mcpPath,
+// followed by the configured extra arguments
+func launchArgs(mcpPath string, config MCPConfig) ([]string, error) {
+	args, err := launchCommand(mcpPath, config)
+	if err != nil {
+		return nil, err
+	}
+	return append(args, config.Args...), nil
+}
+
+// launchCommand returns the command that runs the MCP at mcpPath. An
+// explicit command in the configuration wins. Scripts with a registered
+// launcher and no shebang line run under that launcher;
+// otherwise executables run directly, and other files run under the
+// interpreter named on their shebang line.
+func launchCommand(mcpPath string, config MCPConfig) ([]string, error) {
+	mcpPath = resolveExecutable(mcpPath)
+	if config.Command != "" {
+		args := strings.Fields(config.Command)
+		if len(args) == 0 {
+			return nil, fmt.Errorf("empty command for MCP %s", mcpPath)
+		}
+		return args, nil
+	}
+
+	interpreter := shebang(mcpPath)
+
+	// Scripts without a shebang line can't be run directly even when they
+	// have the executable bit
+	if len(interpreter) == 0 {
+		if len(config.launcher) > 0 {
+			return expandLauncher(config.launcher, mcpPath), nil
+		}
+	}
+
+	info, err := os.Stat(mcpPath)
+	if err != nil {
+		return nil, err
+	}
+	if isExecutable(mcpPath, info) {
+		return []string{mcpPath}, nil
+	}
+
+	if len(interpreter) > 0 {
+		return append(interpreter, mcpPath), nil
+	}
+
+	return nil, errNoLauncher
+}
+
+// isLaunchable reports whether the file at path can be run as an MCP, either
+// directly or through its configured command, a launcher or an interpreter.
+// info describes the file itself, rather than a symlink to it. The caller
+// must hold the lock.
+func (m *MCPManager) isLaunchable(name, path string, info fs.FileInfo) bool {
+	target := resolveExecutable(path)
+	if isExecutable(target, info) {
+		return true
+	}
+
+	if config, err := m.loadMCPConfig(name, path); err == nil && config.Command != "" {
+		return true
+	}
+
+	if len(m.launcherForLocked(path)) > 0 {
+		return true
+	}
+
+	return len(shebang(target)) > 0
+}
+
+// fileInfo describes the file found at path while walking the MCP
+// directory, following it if it is a symlink. Circular or dangling links
+// are reported as errors.
+func fileInfo(path string, d fs.DirEntry) (fs.FileInfo, error) {
+	if d.Type()&fs.ModeSymlink == 0 {
+		return d.Info()
+	}
+
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve symlink: %w", err)
+	}
+	return os.Stat(target)
+}
+
+// resolveExecutable returns the file a symlinked MCP at path points to, so
+// it is run under its own name and next to its own files, or path itself if
+// it isn't a symlink or can't be resolved
+func resolveExecutable(path string) string {
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return path
+	}
+	return target
+}
+
+// shebang returns the interpreter and arguments named on the "#!" line of
+// the file at path, or nil if it has none
+func shebang(path string) []string {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	line, err := bufio.NewReader(file).ReadString('\n')
+	if err != nil && line == "" {
+		return nil
+	}
+	if !strings.HasPrefix(line, "#!") {
+		return nil
+	}
+	return strings.Fields(line[2:])
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Default limits on the complexity of tool call arguments
+const (
+	DefaultMaxArgumentDepth    = 64
+	DefaultMaxArgumentElements = 10000
+)
+
+// DefaultMaxRequestBytes is the default limit on the size of HTTP request bodies
+const DefaultMaxRequestBytes = 10 << 20
+
+// DefaultMaxMCPMessageBytes is the default cap on a single message read from
+// an MCP, so a misbehaving MCP cannot exhaust the server's memory
+const DefaultMaxMCPMessageBytes = 16 << 20
+
+// checkJSONComplexity walks the JSON document in data without building it in
+// memory and rejects it if containers nest deeper than maxDepth or it holds
+// more than maxElements values and object keys. Limits of zero or less are
+// not enforced.
+func checkJSONComplexity(data []byte, maxDepth, maxElements int) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	depth := 0
+	elements := 0
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch token {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+			if maxDepth > 0 && depth > maxDepth {
+				return fmt.Errorf("nesting exceeds maximum depth of %d", maxDepth)
+			}
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+			continue
+		}
+
+		elements++
+		if maxElements > 0 && elements > maxElements {
+			return fmt.Errorf("more than %d elements", maxElements)
+		}
+	}
+}
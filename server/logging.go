@@ -0,0 +1,139 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync/atomic"
+)
+
+// logLevels are the MCP logging levels, from least to most severe
+var logLevels = []string{"debug", "info", "notice", "warning", "error", "critical", "alert", "emergency"}
+
+// DefaultLogLevel is the least severe level of message logged by default
+const DefaultLogLevel = "info"
+
+// logLevelSeverity returns the position of level in logLevels
+func logLevelSeverity(level string) (int, bool) {
+	for i, name := range logLevels {
+		if name == level {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// SetLogLevel sets the least severe level of message the server logs. The
+// level is passed on to running persistent subprocesses whose MCP supports
+// logging, and to those started later.
+func (m *MCPManager) SetLogLevel(level string) error {
+	severity, ok := logLevelSeverity(level)
+	if !ok {
+		return fmt.Errorf("invalid log level: %s", level)
+	}
+	m.logLevel.Store(int32(severity))
+
+	m.processMutex.Lock()
+	procs := make([]*persistentProcess, 0, len(m.processes))
+	for _, proc := range m.processes {
+		procs = append(procs, proc)
+	}
+	m.processMutex.Unlock()
+
+	for _, proc := range procs {
+		go m.setProcessLogLevel(proc, level)
+	}
+	return nil
+}
+
+// LogLevel returns the least severe level of message the server logs
+func (m *MCPManager) LogLevel() string {
+	return logLevels[m.logLevel.Load()]
+}
+
+// logf writes a message at level to stderr, unless the log level filters
+// it out
+func (m *MCPManager) logf(level string, format string, args ...interface{}) {
+	severity, _ := logLevelSeverity(level)
+	if int32(severity) < m.logLevel.Load() {
+		return
+	}
+	fmt.Fprintf(os.Stderr, format, args...)
+}
+
+// logf writes a message at level to stderr, unless the log level filters
+// it out
+func (s *MCPServer) logf(level string, format string, args ...interface{}) {
+	s.mcpManager.logf(level, format, args...)
+}
+
+// clientLogLevel is the least severe level of log notification a client
+// asked for with logging/setLevel. It only filters the notifications relayed
+// to that client; what the server writes to stderr is up to the operator.
+type clientLogLevel struct {
+	// severity is one more than the index into logLevels, or 0 until the
+	// client sets a level
+	severity atomic.Int32
+}
+
+// clientLogLevelKey is the context key for a client's log level
+type clientLogLevelKey struct{}
+
+// withClientLogLevel returns a context carrying the log level of the client
+// whose messages are handled with it
+func withClientLogLevel(ctx context.Context, level *clientLogLevel) context.Context {
+	return context.WithValue(ctx, clientLogLevelKey{}, level)
+}
+
+// clientLogLevelFrom returns the client's log level stored in ctx, if any
+func clientLogLevelFrom(ctx context.Context) *clientLogLevel {
+	level, _ := ctx.Value(clientLogLevelKey{}).(*clientLogLevel)
+	return level
+}
+
+// isSet reports whether the client has set a level
+func (l *clientLogLevel) isSet() bool {
+	return l != nil && l.severity.Load() > 0
+}
+
+// allows reports whether a notification at level is relayed to the client
+func (l *clientLogLevel) allows(level string) bool {
+	severity, ok := logLevelSeverity(level)
+	return ok && int32(severity)+1 >= l.severity.Load()
+}
+
+// notificationRelay returns a function passing the notifications an MCP
+// sends during a tool call on to the client with send: progress
+// notifications if the client asked for progress, and log messages at or
+// above the level it set. It returns nil if nothing is to be relayed.
+func notificationRelay(ctx context.Context, send func(notification []byte)) ProgressFunc {
+	level := clientLogLevelFrom(ctx)
+	wantProgress := progressTokenFrom(ctx) != nil
+	wantLogs := level.isSet()
+	if send == nil || (!wantProgress && !wantLogs) {
+		return nil
+	}
+
+	return func(notification []byte) {
+		var message struct {
+			Method string `json:"method"`
+			Params struct {
+				Level string `json:"level"`
+			} `json:"params"`
+		}
+		if json.Unmarshal(notification, &message) != nil {
+			return
+		}
+		switch message.Method {
+		case "notifications/progress":
+			if wantProgress {
+				send(notification)
+			}
+		case "notifications/message":
+			if wantLogs && level.allows(message.Params.Level) {
+				send(notification)
+			}
+		}
+	}
+}
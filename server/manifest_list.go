@@ -0,0 +1,144 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// ManifestList lists the MCPs to load, as an alternative to scanning the
+// MCP directory, so the tool catalog is fixed by a reviewable file
+type ManifestList struct {
+	MCPs []ManifestEntry `json:"mcps"`
+}
+
+// ManifestEntry describes one MCP of a manifest list. Any other MCPConfig
+// setting, such as group or persistent, may be given next to these fields.
+type ManifestEntry struct {
+	// Name is the name the MCP's tools are served under
+	Name string `json:"name"`
+
+	// Command is the executable that runs the MCP: a path, relative to
+	// the manifest list's directory unless absolute, or a bare name looked
+	// up in PATH. It may be omitted for network MCPs with an endpoint.
+	Command string `json:"command"`
+
+	// Cwd is the directory the subprocess runs in, relative to the
+	// manifest list's directory unless absolute. That directory is also
+	// the default.
+	Cwd string `json:"cwd,omitempty"`
+
+	MCPConfig
+}
+
+// SetManifestList makes LoadMCPs load exactly the MCPs listed in the
+// manifest list at path instead of scanning the MCP directory. An empty
+// path restores the directory scan.
+func (m *MCPManager) SetManifestList(path string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.manifestList = path
+}
+
+// mcpSource describes where MCPs are loaded from, for messages
+func (m *MCPManager) mcpSource() string {
+	if m.manifestList != "" {
+		return m.manifestList
+	}
+	return strings.Join(m.mcpDirectories, ", ")
+}
+
+// loadManifestList loads every MCP in the manifest list. Only a failure to
+// read or parse the list, or ctx being done, is returned; problems with
+// individual entries are recorded as load errors. The caller must hold the
+// write lock.
+func (m *MCPManager) loadManifestList(ctx context.Context) error {
+	data, err := os.ReadFile(m.manifestList)
+	if err != nil {
+		return fmt.Errorf("failed to read manifest list: %w", err)
+	}
+
+	// Reject unknown fields so a misspelled setting isn't silently ignored
+	var list ManifestList
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&list); err != nil {
+		return fmt.Errorf("failed to parse manifest list %s: %w", m.manifestList, err)
+	}
+
+	dir, err := filepath.Abs(filepath.Dir(m.manifestList))
+	if err != nil {
+		return fmt.Errorf("failed to resolve manifest list directory: %w", err)
+	}
+
+	m.listedConfigs = make(map[string]MCPConfig, len(list.MCPs))
+	for i, entry := range list.MCPs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		label := fmt.Sprintf("%s entry %d", m.manifestList, i+1)
+		if entry.Name == "" {
+			m.recordLoadError(label, errors.New("missing name"))
+			continue
+		}
+		label = fmt.Sprintf("%s entry %q", m.manifestList, entry.Name)
+		if _, ok := m.listedConfigs[entry.Name]; ok {
+			m.recordLoadError(label, errors.New("duplicate name"))
+			continue
+		}
+
+		path, config, err := entry.resolve(dir)
+		if err != nil {
+			m.recordLoadError(label, err)
+			continue
+		}
+
+		m.listedConfigs[entry.Name] = config
+		if mcpInfo := m.loadMCP(entry.Name, path); mcpInfo != nil {
+			m.mcpMap[entry.Name] = mcpInfo
+		}
+	}
+	return nil
+}
+
+// resolve returns the path that identifies the MCP of the entry, its
+// executable or, for a network MCP, its endpoint, and the configuration it
+// runs with. Relative paths are resolved against dir.
+func (e ManifestEntry) resolve(dir string) (string, MCPConfig, error) {
+	config := e.MCPConfig
+
+	workingDir := e.Cwd
+	if workingDir == "" {
+		workingDir = config.WorkingDir
+	}
+	if !filepath.IsAbs(workingDir) {
+		workingDir = filepath.Join(dir, workingDir)
+	}
+	config.WorkingDir = workingDir
+
+	switch {
+	case e.Command == "" && config.Endpoint != "":
+		return config.Endpoint, config, nil
+	case e.Command == "":
+		return "", config, errors.New("missing command or endpoint")
+	case strings.ContainsRune(filepath.ToSlash(e.Command), '/'):
+		path := e.Command
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		return path, config, nil
+	default:
+		path, err := exec.LookPath(e.Command)
+		if err != nil {
+			return "", config, err
+		}
+		return path, config, nil
+	}
+}
@@ -0,0 +1,209 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// manifestSuffix is appended to an MCP executable's path to find its manifest
+const manifestSuffix = ".json"
+
+// MCPConfig holds per-MCP settings read from an optional manifest file
+// placed next to the executable (e.g. "mcps/calculator-mcp.json"), or
+// supplied by the server configuration
+type MCPConfig struct {
+	// Group assigns the MCP to a named group, overriding the group implied
+	// by its subdirectory
+	Group string `json:"group,omitempty" yaml:"group"`
+
+	// CloseStdinAfterRequest closes the subprocess stdin once the tools/call
+	// request of a one-shot call is written, so MCPs that read until EOF
+	// know the input is complete. It defaults to true for subprocesses and
+	// false for network MCPs; see closesStdin.
+	CloseStdinAfterRequest *bool `json:"closeStdinAfterRequest,omitempty" yaml:"closeStdinAfterRequest"`
+
+	// Persistent keeps one subprocess running to serve every call instead
+	// of starting a fresh one per call. Calls to the MCP are serialized.
+	Persistent bool `json:"persistent,omitempty" yaml:"persistent"`
+
+	// Instances is the number of persistent subprocesses to run, with calls
+	// sent to the least busy one. It only applies to persistent MCPs.
+	Instances int `json:"instances,omitempty" yaml:"instances"`
+
+	// MaxLifetimeSeconds is how long a persistent subprocess may run before
+	// it is replaced by a fresh one, for MCPs that leak memory. Zero means
+	// no limit.
+	MaxLifetimeSeconds int `json:"maxLifetimeSeconds,omitempty" yaml:"maxLifetimeSeconds"`
+
+	// MaxMessageBytes caps the size of a single message read from the MCP,
+	// DefaultMaxMCPMessageBytes if unset. An MCP that writes a larger one
+	// fails the request it was answering.
+	MaxMessageBytes int `json:"maxMessageBytes,omitempty" yaml:"maxMessageBytes"`
+
+	// Framing is how messages written to the MCP are framed: "newline" (the
+	// default) for newline-delimited JSON, or "content-length" for LSP-style
+	// Content-Length headers. Messages the MCP writes may use either.
+	Framing string `json:"framing,omitempty" yaml:"framing"`
+
+	// StderrResponses also accepts JSON-RPC messages the subprocess writes
+	// to stderr, for MCPs that mistakenly answer there. Other stderr output
+	// is discarded as usual.
+	StderrResponses bool `json:"stderrResponses,omitempty" yaml:"stderrResponses"`
+
+	// InitializeParams are merged into the params of the initialize request,
+	// for MCPs that expect extra fields such as client capabilities
+	InitializeParams map[string]interface{} `json:"initializeParams,omitempty" yaml:"initializeParams"`
+
+	// Endpoint is the address of an MCP that listens on the network instead
+	// of speaking stdio, as tcp://host:port. The MCP is connected to rather
+	// than started, so the settings for its subprocess don't apply.
+	Endpoint string `json:"endpoint,omitempty" yaml:"endpoint"`
+
+	// Command is the command line that runs the MCP, split on whitespace,
+	// for MCPs that need an interpreter or extra arguments. It runs in the
+	// working directory, so it can refer to the file by its base name.
+	Command string `json:"command,omitempty" yaml:"command"`
+
+	// Args are extra arguments appended to the command line that runs the
+	// MCP
+	Args []string `json:"args,omitempty" yaml:"args"`
+
+	// Env holds environment variables set for the subprocess on top of the
+	// server's own environment
+	Env map[string]string `json:"env,omitempty" yaml:"env"`
+
+	// WorkingDir is the directory the subprocess runs in. Relative paths are
+	// resolved against the executable's directory, which is also the default.
+	WorkingDir string `json:"workingDir,omitempty" yaml:"workingDir"`
+
+	// RunAsUser and RunAsGroup name the user and group, or numeric ids, the
+	// subprocess runs as on Unix. The server must run as root to use them.
+	RunAsUser  string `json:"runAsUser,omitempty" yaml:"runAsUser"`
+	RunAsGroup string `json:"runAsGroup,omitempty" yaml:"runAsGroup"`
+
+	// Limits caps the resources the subprocess may use
+	Limits ResourceLimits `json:"limits,omitempty" yaml:"limits"`
+
+	// Tools holds settings for individual tools, keyed by the tool's name
+	// within the MCP
+	Tools map[string]ToolConfig `json:"tools,omitempty" yaml:"tools"`
+
+	// launcher is the command template registered for the MCP's extension,
+	// filled in when the MCP is loaded
+	launcher []string
+}
+
+// ToolConfig holds the settings of a single tool
+type ToolConfig struct {
+	// Cacheable caches the successful results of the tool, so identical
+	// calls are answered without running the MCP. Only mark tools that are
+	// read-only and idempotent.
+	Cacheable bool `json:"cacheable,omitempty" yaml:"cacheable"`
+
+	// CacheTTLSeconds is how long cached results are used, one minute if
+	// unset
+	CacheTTLSeconds int `json:"cacheTTLSeconds,omitempty" yaml:"cacheTTLSeconds"`
+
+	// TimeoutSeconds limits calls of the tool, overriding the server's
+	// default for tool calls
+	TimeoutSeconds int `json:"timeoutSeconds,omitempty" yaml:"timeoutSeconds"`
+}
+
+// instanceCount returns the number of subprocesses serving a persistent MCP
+func (c MCPConfig) instanceCount() int {
+	if c.Instances < 1 {
+		return 1
+	}
+	return c.Instances
+}
+
+// maxLifetime returns how long a persistent subprocess may run, or zero for
+// no limit
+func (c MCPConfig) maxLifetime() time.Duration {
+	if c.MaxLifetimeSeconds <= 0 {
+		return 0
+	}
+	return time.Duration(c.MaxLifetimeSeconds) * time.Second
+}
+
+// maxMessageBytes returns the cap on the size of messages read from the MCP
+func (c MCPConfig) maxMessageBytes() int {
+	if c.MaxMessageBytes <= 0 {
+		return DefaultMaxMCPMessageBytes
+	}
+	return c.MaxMessageBytes
+}
+
+// closesStdin reports whether stdin is closed after the tools/call request
+// of a one-shot call. Unless configured, a subprocess has its stdin closed
+// and a network connection is left open for writing.
+func (c MCPConfig) closesStdin() bool {
+	if c.CloseStdinAfterRequest != nil {
+		return *c.CloseStdinAfterRequest
+	}
+	return c.Endpoint == ""
+}
+
+// ResourceLimits are rlimits applied to an MCP subprocess on Linux. A zero
+// value leaves the corresponding resource unlimited.
+type ResourceLimits struct {
+	// MaxMemoryBytes caps the address space of the subprocess
+	MaxMemoryBytes uint64 `json:"maxMemoryBytes,omitempty" yaml:"maxMemoryBytes"`
+
+	// MaxCPUSeconds caps the CPU time the subprocess may consume
+	MaxCPUSeconds uint64 `json:"maxCPUSeconds,omitempty" yaml:"maxCPUSeconds"`
+
+	// MaxOpenFiles caps the number of file descriptors the subprocess may open
+	MaxOpenFiles uint64 `json:"maxOpenFiles,omitempty" yaml:"maxOpenFiles"`
+}
+
+// isSet reports whether any limit is configured
+func (l ResourceLimits) isSet() bool {
+	return l.MaxMemoryBytes > 0 || l.MaxCPUSeconds > 0 || l.MaxOpenFiles > 0
+}
+
+// loadMCPConfig returns the configuration for the MCP named name at mcpPath.
+// The entry of an MCP listed in the manifest list takes precedence, then
+// configuration supplied through SetMCPConfigs; otherwise the manifest is
+// read. A missing manifest is not an error and yields the default
+// configuration. The caller must hold the lock.
+func (m *MCPManager) loadMCPConfig(name, mcpPath string) (MCPConfig, error) {
+	if config, ok := m.listedConfigs[name]; ok {
+		return config, nil
+	}
+	if config, ok := m.mcpConfigs[name]; ok {
+		return config, nil
+	}
+
+	var config MCPConfig
+
+	data, err := os.ReadFile(mcpPath + manifestSuffix)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return config, nil
+		}
+		return config, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+
+	return config, nil
+}
+
+// SetMCPConfigs supplies per-MCP configuration keyed by MCP name, used in
+// place of the manifests of those MCPs on the next load
+func (m *MCPManager) SetMCPConfigs(configs map[string]MCPConfig) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.mcpConfigs = make(map[string]MCPConfig, len(configs))
+	for name, config := range configs {
+		m.mcpConfigs[name] = config
+	}
+}
@@ -3,162 +3,731 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/fs"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/singleflight"
 )
 
+// ToolNameSeparator joins an MCP's name and its tool names into the names
+// tools are served under, e.g. "calculator-mcp.add"
+const ToolNameSeparator = "."
+
+// ErrNoMCPs is returned by LoadMCPs when the MCP directory holds no MCPs
+// and SetFailIfEmpty is in effect
+var ErrNoMCPs = errors.New("no MCPs found")
+
 // ToolInfo represents information about a tool
 type ToolInfo struct {
-	Name        string                 `json:"name"`
-	Description string                 `json:"description,omitempty"`
-	Parameters  map[string]interface{} `json:"parameters,omitempty"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Parameters is the JSON schema of the tool's arguments, MCP's
+	// inputSchema
+	Parameters map[string]interface{} `json:"inputSchema,omitempty"`
+	// OutputSchema is kept as raw JSON so it is passed through to clients
+	// exactly as the MCP advertised it
+	OutputSchema json.RawMessage `json:"outputSchema,omitempty"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler. The input schema is also read
+// from "parameters", the name used by older MCPs and tool caches.
+func (t *ToolInfo) UnmarshalJSON(data []byte) error {
+	type plain ToolInfo
+	var tool struct {
+		plain
+		LegacyParameters map[string]interface{} `json:"parameters"`
+	}
+	if err := json.Unmarshal(data, &tool); err != nil {
+		return err
+	}
+	*t = ToolInfo(tool.plain)
+	if t.Parameters == nil {
+		t.Parameters = tool.LegacyParameters
+	}
+	return nil
 }
 
+// defaultInputSchema returns the input schema listed for a tool whose MCP
+// didn't advertise one, which accepts an object of any arguments
+func defaultInputSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{},
+	}
+}
+
+// MCP load statuses reported in the server inventory
+const (
+	MCPStatusLoaded = "loaded"
+	MCPStatusFailed = "failed"
+)
+
 // MCPInfo stores information about an MCP executable
 type MCPInfo struct {
 	Name      string
 	Path      string
+	Group     string
+	Config    MCPConfig
+	Status    string
+	Health    string
 	ToolInfos []ToolInfo
+
+	// ProtocolVersion is the protocol version the MCP agreed to when its
+	// tools were last discovered, or empty if it didn't say
+	ProtocolVersion string
+
+	// ServerName, ServerVersion and Instructions are the serverInfo and
+	// instructions of the MCP's initialize result when its tools were last
+	// discovered, or empty if it didn't give them
+	ServerName    string
+	ServerVersion string
+	Instructions  string
+
+	// Capabilities, Resources and Prompts are what the MCP advertised when
+	// its tools were last discovered, as raw JSON
+	Capabilities json.RawMessage
+	Resources    json.RawMessage
+	Prompts      json.RawMessage
+
+	// breaker tracks recent failures; it is guarded by the manager mutex
+	breaker circuitBreaker
+}
+
+// MCPSummary is the client-facing description of a loaded MCP
+type MCPSummary struct {
+	Name      string `json:"name"`
+	Path      string `json:"path"`
+	Group     string `json:"group,omitempty"`
+	ToolCount int    `json:"toolCount"`
+	Status    string `json:"status"`
+	Health    string `json:"health"`
+	Enabled   bool   `json:"enabled"`
+
+	ProtocolVersion string `json:"protocolVersion,omitempty"`
+	ServerName      string `json:"serverName,omitempty"`
+	ServerVersion   string `json:"serverVersion,omitempty"`
+}
+
+// MCPDescription is the client-facing description of a loaded MCP with what
+// it advertises in full, as returned by the describe_mcp tool
+type MCPDescription struct {
+	MCPSummary
+
+	Instructions string          `json:"instructions,omitempty"`
+	Capabilities json.RawMessage `json:"capabilities,omitempty"`
+	Tools        []ToolInfo      `json:"tools"`
+	Resources    json.RawMessage `json:"resources,omitempty"`
+	Prompts      json.RawMessage `json:"prompts,omitempty"`
+}
+
+// LoadError records an MCP that could not be loaded
+type LoadError struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
 }
 
 // MCPManager manages a collection of MCP executables
 type MCPManager struct {
-	mcpMap       map[string]*MCPInfo
-	mcpDirectory string
-	mutex        sync.RWMutex
+	mcpMap     map[string]*MCPInfo
+	loadErrors []LoadError
+	mutex      sync.RWMutex
+
+	// mcpDirectories are the roots scanned for MCPs, in order, and
+	// dirConflicts says how an MCP name found under more than one of them
+	// is resolved
+	mcpDirectories []string
+	dirConflicts   string
+
+	// Circuit breaker settings applied to every MCP
+	breakerThreshold int
+	breakerWindow    time.Duration
+	breakerCooldown  time.Duration
+
+	// allowPatterns and denyPatterns filter the tools that are served
+	allowPatterns []string
+	denyPatterns  []string
+
+	// processes holds the running subprocesses of persistent MCPs by
+	// instance key, and nextInstance the instance of each MCP to consider
+	// first for its next call
+	processes    map[string]*persistentProcess
+	nextInstance map[string]int
+	processMutex sync.Mutex
+
+	// crashes counts the consecutive crashes of persistent subprocesses by
+	// instance key, and stopping is set once they are being shut down for
+	// good; both are guarded by processMutex
+	crashes  map[string]int
+	stopping bool
+
+	// shutdowns tracks the subprocesses of persistent MCPs being shut down
+	shutdowns sync.WaitGroup
+
+	// aliases maps alternative tool names to namespaced tools, and
+	// aliasByTarget holds the aliases in effect for the loaded tools
+	aliases       map[string]string
+	aliasByTarget map[string]string
+
+	// toolCache holds previously discovered tools, if caching is enabled
+	toolCache *toolCache
+
+	// mcpConfigs overrides the manifests of the named MCPs
+	mcpConfigs map[string]MCPConfig
+
+	// argTransformers reshape the arguments of calls to MCPs, by MCP name
+	argTransformers map[string]ArgTransformer
+
+	// launchers maps script extensions to the command templates that run
+	// them
+	launchers map[string][]string
+
+	// manifestList is the file listing the MCPs to load in place of the
+	// MCP directory, if set, and listedConfigs holds the configuration of
+	// each MCP it listed on the last load
+	manifestList  string
+	listedConfigs map[string]MCPConfig
+
+	// disabledGroups holds groups whose tools are not served; it survives
+	// reloads so a disabled group stays disabled
+	disabledGroups map[string]bool
+
+	// disabledMCPs holds MCPs, by name, whose tools are not served
+	disabledMCPs map[string]bool
+
+	// logPayloads enables logging of tool call payloads, masking the values
+	// of the keys in redactKeys
+	logPayloads bool
+	redactKeys  map[string]bool
+
+	// failIfEmpty makes finding no MCPs a load error
+	failIfEmpty bool
+
+	// protocolVersion is requested from MCPs in the initialize handshake
+	protocolVersion string
+
+	// discoveryTimeout bounds discovering an MCP's tools and execTimeout
+	// tool calls, unless a tool sets its own; zero means no limit
+	discoveryTimeout time.Duration
+	execTimeout      time.Duration
+
+	// passthrough serves the tools of a lone MCP without the MCP name prefix
+	passthrough bool
+
+	// coalesce shares one execution between identical concurrent calls,
+	// which flights tracks
+	coalesce bool
+	flights  singleflight.Group
+
+	// results caches the results of tools marked cacheable
+	results *resultCache
+
+	// runner starts MCP subprocesses
+	runner      CommandRunner
+	runnerMutex sync.RWMutex
+
+	// calls tracks tool calls in flight so they can be drained, and inFlight
+	// counts them. draining is set once new calls are refused; calls.Add and
+	// draining are guarded by callsMutex.
+	calls      sync.WaitGroup
+	inFlight   atomic.Int64
+	draining   bool
+	callsMutex sync.Mutex
+
+	// logLevel is the severity, an index into logLevels, of the least
+	// severe messages logged
+	logLevel atomic.Int32
+
+	// loaded is set once LoadMCPs completes; it is atomic so readiness
+	// checks don't wait on the lock
+	loaded atomic.Bool
+
+	// loadMutex serializes loads, which release the write lock while they
+	// discover tools. discoveries holds the MCPs a load has found whose
+	// tools are yet to be discovered.
+	loadMutex   sync.Mutex
+	discoveries []*pendingDiscovery
 }
 
-// NewMCPManager creates a new MCP manager
-func NewMCPManager(mcpDirectory string) *MCPManager {
-	return &MCPManager{
-		mcpMap:       make(map[string]*MCPInfo),
-		mcpDirectory: mcpDirectory,
+// NewMCPManager creates a new MCP manager scanning the given MCP
+// directories, later ones taking precedence for MCPs of the same name
+func NewMCPManager(mcpDirectories ...string) *MCPManager {
+	m := &MCPManager{
+		mcpMap:         make(map[string]*MCPInfo),
+		mcpDirectories: append([]string{}, mcpDirectories...),
+		dirConflicts:   DirConflictOverride,
+		disabledGroups: make(map[string]bool),
+		disabledMCPs:   make(map[string]bool),
+		processes:      make(map[string]*persistentProcess),
+		crashes:        make(map[string]int),
+		nextInstance:   make(map[string]int),
+		runner:         execRunner{},
+		results:        newResultCache(DefaultResultCacheSize),
+
+		breakerThreshold: DefaultBreakerThreshold,
+		breakerWindow:    DefaultBreakerWindow,
+		breakerCooldown:  DefaultBreakerCooldown,
+		protocolVersion:  DefaultProtocolVersion,
+		discoveryTimeout: DefaultDiscoveryTimeout,
 	}
+	m.SetLogLevel(DefaultLogLevel)
+	m.SetLaunchers(nil)
+	return m
 }
 
-// LoadMCPs loads all MCPs from the configured directory
-func (m *MCPManager) LoadMCPs() error {
+// LoadMCPs loads all MCPs from the configured directory, or those listed in
+// the manifest list if one is set. Only a failure to read the directory or
+// the list itself, or ctx being done, is returned; problems with
+// individual MCPs are recorded and available through LoadErrors. A load
+// abandoned because ctx is done leaves the previously loaded MCPs in place.
+// The previously loaded MCPs keep serving calls while the new ones' tools
+// are discovered.
+func (m *MCPManager) LoadMCPs(ctx context.Context) error {
+	m.loadMutex.Lock()
+	defer m.loadMutex.Unlock()
+
+	// Find the MCPs into a fresh state, keeping the current one in place
+	// until their tools are discovered
+	m.mutex.Lock()
+	wasLoaded := m.loaded.Load()
+	m.loaded.Store(false)
+	previous := m.swapLoadState(loadState{mcpMap: make(map[string]*MCPInfo)})
+	err := m.findMCPs(ctx)
+	staged := m.swapLoadState(previous)
+	pending, protocolVersion, timeout := m.takeDiscoveries()
+	m.mutex.Unlock()
+
+	m.discoverPending(ctx, pending, protocolVersion, timeout)
+
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
+	if ctx.Err() != nil {
+		m.loaded.Store(wasLoaded)
+		if err == nil {
+			err = ctx.Err()
+		}
+		return err
+	}
 
-	// Clear existing MCPs
-	m.mcpMap = make(map[string]*MCPInfo)
+	previous = m.swapLoadState(staged)
+	restore := func() {
+		m.swapLoadState(previous)
+		m.loaded.Store(wasLoaded)
+	}
+	for _, p := range pending {
+		m.finishDiscovery(p)
+	}
+	if err != nil {
+		return err
+	}
+	if err := m.checkPassthroughLocked(); err != nil {
+		restore()
+		return err
+	}
+	if len(m.mcpMap) == 0 {
+		if m.failIfEmpty {
+			restore()
+			return fmt.Errorf("%w in %s", ErrNoMCPs, m.mcpSource())
+		}
+		m.logf("warning", "Warning: No MCPs found in %s; no tools will be served\n", m.mcpSource())
+	}
 
-	// Walk through the MCP directory
-	return filepath.WalkDir(m.mcpDirectory, func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
+	m.checkAliasesLocked()
+	m.saveToolCache()
+	m.loaded.Store(true)
+	return nil
+}
+
+// loadState is the part of the manager's state a load replaces
+type loadState struct {
+	mcpMap        map[string]*MCPInfo
+	loadErrors    []LoadError
+	listedConfigs map[string]MCPConfig
+}
+
+// swapLoadState installs state and returns the state it replaces. The
+// caller must hold the write lock.
+func (m *MCPManager) swapLoadState(state loadState) loadState {
+	previous := loadState{mcpMap: m.mcpMap, loadErrors: m.loadErrors, listedConfigs: m.listedConfigs}
+	m.mcpMap, m.loadErrors, m.listedConfigs = state.mcpMap, state.loadErrors, state.listedConfigs
+	return previous
+}
+
+// findMCPs loads the MCPs listed in the manifest list, or those found in
+// the MCP directories, and the network MCPs configured without any file in
+// the directory. Their tools are discovered later. Only a failure to read
+// the directory or the list itself, or ctx being done, is returned. The
+// caller must hold the write lock.
+func (m *MCPManager) findMCPs(ctx context.Context) error {
+	var err error
+	if m.manifestList != "" {
+		err = m.loadManifestList(ctx)
+	} else {
+		err = m.scanMCPDirectory(ctx)
+	}
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(m.mcpConfigs))
+	for name := range m.mcpConfigs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		endpoint := m.mcpConfigs[name].Endpoint
+		if endpoint == "" || m.mcpMap[name] != nil {
+			continue
+		}
+		if mcpInfo := m.loadMCP(name, endpoint); mcpInfo != nil {
+			m.mcpMap[name] = mcpInfo
+		}
+	}
+	return nil
+}
+
+// scanMCPDirectory loads every MCP found in the MCP directories. An MCP
+// name found under more than one directory is resolved by the directory
+// conflict setting. Only a failure to read a directory itself, or ctx being
+// done, is returned. The caller must hold the write lock.
+func (m *MCPManager) scanMCPDirectory(ctx context.Context) error {
+	// Walk the directory that wins a conflict first, so the MCPs it shadows
+	// are never started
+	roots := append([]string{}, m.mcpDirectories...)
+	if m.dirConflicts == DirConflictOverride {
+		slices.Reverse(roots)
+	}
+
+	found := make(map[string]string)
+	for _, root := range roots {
+		if err := m.scanMCPRoot(ctx, root, found); err != nil {
 			return err
 		}
+	}
+	return nil
+}
+
+// scanMCPRoot loads every MCP found in the MCP directory root whose name
+// isn't in found, the paths of the MCPs found so far by name, and adds them
+// to it. The caller must hold the write lock.
+func (m *MCPManager) scanMCPRoot(ctx context.Context, root string, found map[string]string) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			if path == root {
+				return err
+			}
+			m.recordLoadError(path, err)
+			return nil
+		}
 
 		// Skip directories
 		if d.IsDir() {
 			return nil
 		}
 
-		// Skip non-executable files
-		info, err := d.Info()
+		// Skip manifests, which may have been copied with the executable bit,
+		// unless they stand alone and describe a network MCP
+		if strings.HasSuffix(path, manifestSuffix) {
+			name, mcpPath, ok := m.networkManifestMCP(root, path)
+			if ok && m.claimMCPName(found, name, mcpPath) {
+				if mcpInfo := m.loadMCP(name, mcpPath); mcpInfo != nil {
+					m.mcpMap[name] = mcpInfo
+				}
+			}
+			return nil
+		}
+
+		// Name the MCP after its path within the directory
+		name := mcpName(root, path)
+
+		// Skip files that can't be run, directly or through an interpreter.
+		// Symlinks are judged by what they point to; symlinked directories
+		// aren't followed.
+		info, err := fileInfo(path, d)
 		if err != nil {
-			return err
+			m.recordLoadError(path, err)
+			return nil
+		}
+		if info.IsDir() || !m.isLaunchable(name, path, info) {
+			return nil
 		}
-		if info.Mode()&0111 == 0 {
+		if !m.claimMCPName(found, name, path) {
 			return nil
 		}
 
-		// Get the base name without extension
-		name := filepath.Base(path)
-		ext := filepath.Ext(name)
-		if ext != "" {
-			name = name[:len(name)-len(ext)]
+		// Load the MCP and store its info
+		if mcpInfo := m.loadMCP(name, path); mcpInfo != nil {
+			m.mcpMap[name] = mcpInfo
 		}
 
-		// Create MCP info
-		mcpInfo := &MCPInfo{
-			Name: name,
-			Path: path,
+		return nil
+	})
+}
+
+// SetFailIfEmpty makes LoadMCPs fail with ErrNoMCPs, keeping the MCPs
+// loaded before, if it finds no MCPs
+func (m *MCPManager) SetFailIfEmpty(enabled bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.failIfEmpty = enabled
+}
+
+// loadMCP reads the manifest for the MCP executable at path and takes its
+// tools from the cache, or queues their discovery. Failures are recorded as
+// load errors; nil is returned if the MCP can't be used at all. The caller
+// must hold the write lock.
+func (m *MCPManager) loadMCP(name, path string) *MCPInfo {
+	// Read the optional manifest
+	config, err := m.loadMCPConfig(name, path)
+	if err != nil {
+		m.recordLoadError(path, err)
+		return nil
+	}
+
+	// Refuse to run the MCP with more privileges than it asked for
+	if err := checkCredential(config); err != nil {
+		m.recordLoadError(path, err)
+		return nil
+	}
+	config.launcher = m.launcherForLocked(path)
+
+	// Create MCP info
+	mcpInfo := &MCPInfo{
+		Name:   name,
+		Path:   path,
+		Group:  m.groupFor(path, config),
+		Config: config,
+		Status: MCPStatusLoaded,
+		Health: MCPHealthHealthy,
+	}
+
+	// Use the cached tools if the MCP is unchanged, otherwise discover them
+	// once the lock is released
+	pending := &pendingDiscovery{mcpInfo: mcpInfo}
+	pending.cacheKey, pending.cacheState, pending.cacheable = m.toolCacheState(path, config)
+	if pending.cacheable {
+		if discovery, ok := m.cachedTools(pending.cacheKey, pending.cacheState); ok {
+			mcpInfo.setDiscovery(discovery)
+			m.logf("info", "Loaded MCP: %s from %s with %d tools\n", name, path, len(mcpInfo.ToolInfos))
+			return mcpInfo
 		}
+	}
+	m.discoveries = append(m.discoveries, pending)
+	return mcpInfo
+}
 
-		// Try to get tool info
-		toolInfos, err := m.getToolInfos(path)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Warning: Failed to get tool info for %s: %v\n", path, err)
-		} else {
-			mcpInfo.ToolInfos = toolInfos
+// pendingDiscovery is an MCP found by a load whose tools are discovered
+// without holding the lock, so a slow MCP doesn't hold up calls to the MCPs
+// already loaded
+type pendingDiscovery struct {
+	mcpInfo *MCPInfo
+
+	// cacheKey and cacheState describe the MCP to the tool cache, if
+	// cacheable is set
+	cacheKey   string
+	cacheState toolCacheEntry
+	cacheable  bool
+
+	discovery mcpDiscovery
+	err       error
+}
+
+// takeDiscoveries returns the discoveries queued by a load and the protocol
+// version and timeout to run them with. The caller must hold the write
+// lock.
+func (m *MCPManager) takeDiscoveries() ([]*pendingDiscovery, string, time.Duration) {
+	pending := m.discoveries
+	m.discoveries = nil
+	return pending, m.protocolVersion, m.discoveryTimeout
+}
+
+// discoverPending discovers the tools of each pending MCP in turn until ctx
+// is done. The lock must not be held.
+func (m *MCPManager) discoverPending(ctx context.Context, pending []*pendingDiscovery, protocolVersion string, timeout time.Duration) {
+	for _, p := range pending {
+		if ctx.Err() != nil {
+			return
 		}
+		p.discovery, p.err = m.getToolInfos(ctx, protocolVersion, timeout, p.mcpInfo.Path, p.mcpInfo.Config)
+	}
+}
+
+// finishDiscovery records the outcome of discovering the tools of a pending
+// MCP in its info, the load errors and the tool cache. The caller must hold
+// the write lock.
+func (m *MCPManager) finishDiscovery(p *pendingDiscovery) {
+	mcpInfo := p.mcpInfo
+	if p.err != nil {
+		m.recordLoadError(mcpInfo.Path, fmt.Errorf("failed to get tool info: %w", p.err))
+		mcpInfo.Status = MCPStatusFailed
+		mcpInfo.Health = MCPHealthUnhealthy
+	} else {
+		mcpInfo.setDiscovery(p.discovery)
+	}
+	if p.cacheable {
+		m.cacheTools(p.cacheKey, p.cacheState, p.discovery, p.err)
+	}
 
-		// Store MCP info
-		m.mcpMap[name] = mcpInfo
-		fmt.Fprintf(os.Stderr, "Loaded MCP: %s from %s with %d tools\n", name, path, len(mcpInfo.ToolInfos))
+	m.logf("info", "Loaded MCP: %s from %s with %d tools\n", mcpInfo.Name, mcpInfo.Path, len(mcpInfo.ToolInfos))
+}
 
-		return nil
+// Loaded reports whether the most recent LoadMCPs call has completed successfully
+func (m *MCPManager) Loaded() bool {
+	return m.loaded.Load()
+}
+
+// recordLoadError logs and records a failure to load the MCP at path.
+// The caller must hold the write lock.
+func (m *MCPManager) recordLoadError(path string, err error) {
+	m.logf("warning", "Warning: Failed to load MCP %s: %v\n", path, err)
+	m.loadErrors = append(m.loadErrors, LoadError{
+		Path:  path,
+		Error: err.Error(),
 	})
 }
 
-// getToolInfos queries an MCP executable for its tool information
-func (m *MCPManager) getToolInfos(mcpPath string) ([]ToolInfo, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+// LoadErrors returns the errors encountered during the last LoadMCPs call
+func (m *MCPManager) LoadErrors() []LoadError {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	loadErrors := make([]LoadError, len(m.loadErrors))
+	copy(loadErrors, m.loadErrors)
+	return loadErrors
+}
 
-	// Create a temporary client to get the tool info
-	cmd := exec.CommandContext(ctx, mcpPath)
-	stdin, err := cmd.StdinPipe()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get stdin pipe: %w", err)
+// GetMCPSummaries returns a summary of every loaded MCP, sorted by name
+func (m *MCPManager) GetMCPSummaries() []MCPSummary {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	summaries := make([]MCPSummary, 0, len(m.mcpMap))
+	for _, mcpInfo := range m.mcpMap {
+		summaries = append(summaries, m.summarize(mcpInfo))
 	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].Name < summaries[j].Name
+	})
+	return summaries
+}
 
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get stdout pipe: %w", err)
+// summarize returns the summary of mcpInfo. The caller must hold the lock.
+func (m *MCPManager) summarize(mcpInfo *MCPInfo) MCPSummary {
+	return MCPSummary{
+		Name:      mcpInfo.Name,
+		Path:      mcpInfo.Path,
+		Group:     mcpInfo.Group,
+		ToolCount: len(mcpInfo.ToolInfos),
+		Status:    mcpInfo.Status,
+		Health:    mcpInfo.Health,
+		Enabled:   m.isEnabled(mcpInfo),
+
+		ProtocolVersion: mcpInfo.ProtocolVersion,
+		ServerName:      mcpInfo.ServerName,
+		ServerVersion:   mcpInfo.ServerVersion,
 	}
+}
 
-	// Start the command
-	if err := cmd.Start(); err != nil {
-		return nil, fmt.Errorf("failed to start MCP: %w", err)
+// DescribeMCP returns everything the named MCP advertised when its tools
+// were last discovered, with its tools under their names within the MCP.
+// Filtered tools are left out, and disabled MCPs look as if they don't
+// exist.
+func (m *MCPManager) DescribeMCP(name string) (MCPDescription, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	mcpInfo, ok := m.mcpMap[name]
+	if !ok || !m.isEnabled(mcpInfo) {
+		return MCPDescription{}, fmt.Errorf("no MCP named %s", name)
 	}
 
-	// Create a simple JSON-RPC client
-	// First, initialize the MCP
-	initMsg := `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocol_version":"2024-11-05"}}`
-	_, err = stdin.Write([]byte(initMsg + "\n"))
-	if err != nil {
-		cmd.Process.Kill()
-		return nil, fmt.Errorf("failed to send initialize message: %w", err)
+	tools := make([]ToolInfo, 0, len(mcpInfo.ToolInfos))
+	for _, tool := range mcpInfo.ToolInfos {
+		if m.toolAllowed(name + ToolNameSeparator + tool.Name) {
+			tools = append(tools, tool)
+		}
 	}
 
-	// Read the initialize response (we don't need to parse it)
-	buffer := make([]byte, 4096)
-	_, err = stdout.Read(buffer)
-	if err != nil {
-		cmd.Process.Kill()
-		return nil, fmt.Errorf("failed to read initialize response: %w", err)
+	return MCPDescription{
+		MCPSummary:   m.summarize(mcpInfo),
+		Instructions: mcpInfo.Instructions,
+		Capabilities: mcpInfo.Capabilities,
+		Tools:        tools,
+		Resources:    mcpInfo.Resources,
+		Prompts:      mcpInfo.Prompts,
+	}, nil
+}
+
+// mcpDiscovery is what an MCP advertises when it is queried for its tools
+type mcpDiscovery struct {
+	Tools []ToolInfo `json:"tools"`
+
+	// ProtocolVersion is the protocol version the MCP agreed to
+	ProtocolVersion string `json:"protocolVersion,omitempty"`
+
+	// ServerName and ServerVersion are the serverInfo of the initialize
+	// result, and Instructions its instructions for using the MCP
+	ServerName    string `json:"serverName,omitempty"`
+	ServerVersion string `json:"serverVersion,omitempty"`
+	Instructions  string `json:"instructions,omitempty"`
+
+	// Capabilities is the capabilities object of the initialize result,
+	// and Resources and Prompts the resources and prompts the MCP lists if
+	// it advertises them
+	Capabilities json.RawMessage `json:"capabilities,omitempty"`
+	Resources    json.RawMessage `json:"resources,omitempty"`
+	Prompts      json.RawMessage `json:"prompts,omitempty"`
+}
+
+// setDiscovery records what the MCP advertised when its tools were
+// discovered. The caller must hold the write lock.
+func (i *MCPInfo) setDiscovery(discovery mcpDiscovery) {
+	i.ToolInfos = discovery.Tools
+	i.ProtocolVersion = discovery.ProtocolVersion
+	i.ServerName = discovery.ServerName
+	i.ServerVersion = discovery.ServerVersion
+	i.Instructions = discovery.Instructions
+	i.Capabilities = discovery.Capabilities
+	i.Resources = discovery.Resources
+	i.Prompts = discovery.Prompts
+}
+
+// getToolInfos queries an MCP executable for its tool information,
+// requesting protocolVersion, along with the protocol version the MCP
+// agreed to, what it says about itself, its capabilities, and the resources
+// and prompts it lists. The query is abandoned, and the subprocess killed,
+// when ctx is done or after timeout, unless it is zero.
+func (m *MCPManager) getToolInfos(ctx context.Context, protocolVersion string, timeout time.Duration, mcpPath string, config MCPConfig) (mcpDiscovery, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
 	}
 
-	// Now, send the tools/list request
-	listMsg := `{"jsonrpc":"2.0","id":2,"method":"tools/list"}`
-	_, err = stdin.Write([]byte(listMsg + "\n"))
+	session, err := startSession(ctx, m.commandRunner(), protocolVersion, mcpPath, config)
 	if err != nil {
-		cmd.Process.Kill()
-		return nil, fmt.Errorf("failed to send tools/list message: %w", err)
+		return mcpDiscovery{}, err
 	}
+	defer session.kill()
 
-	// Read the tools/list response
-	n, err := stdout.Read(buffer)
+	response, err := session.request(ctx, "tools/list", nil, nil)
 	if err != nil {
-		cmd.Process.Kill()
-		return nil, fmt.Errorf("failed to read tools/list response: %w", err)
+		return mcpDiscovery{}, err
 	}
 
-	// Kill the process
-	cmd.Process.Kill()
-
-	// Parse the response to get the tool info
-	response := buffer[:n]
-
 	// Parse the JSON-RPC response
 	var resp struct {
 		Result struct {
@@ -167,135 +736,334 @@ func (m *MCPManager) getToolInfos(mcpPath string) ([]ToolInfo, error) {
 	}
 
 	if err := json.Unmarshal(response, &resp); err != nil {
-		return nil, fmt.Errorf("failed to parse tools/list response: %w", err)
+		return mcpDiscovery{}, fmt.Errorf("failed to parse tools/list response: %w", err)
+	}
+
+	discovery := mcpDiscovery{
+		Tools:           resp.Result.Tools,
+		ProtocolVersion: session.protocolVersion,
+		ServerName:      session.serverName,
+		ServerVersion:   session.serverVersion,
+		Instructions:    session.instructions,
+		Capabilities:    session.capabilities,
+	}
+
+	// Resources and prompts are only informational, so an MCP that fails
+	// to list them still loads
+	if session.hasCapability("resources") {
+		discovery.Resources = m.listOptional(ctx, session, mcpPath, "resources/list", "resources")
+	}
+	if session.hasCapability("prompts") {
+		discovery.Prompts = m.listOptional(ctx, session, mcpPath, "prompts/list", "prompts")
 	}
 
-	return resp.Result.Tools, nil
+	return discovery, nil
 }
 
-// GetAllTools returns all tools from all MCPs
+// listOptional sends a list request, such as resources/list, and returns
+// the given member of its result, or nil with a warning if that fails
+func (m *MCPManager) listOptional(ctx context.Context, session *mcpSession, mcpPath, method, member string) json.RawMessage {
+	response, err := session.request(ctx, method, nil, nil)
+	if err != nil {
+		m.logf("warning", "Warning: MCP %s failed %s: %v\n", mcpPath, method, err)
+		return nil
+	}
+
+	var resp struct {
+		Result map[string]json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(response, &resp); err != nil {
+		m.logf("warning", "Warning: Failed to parse %s response of MCP %s: %v\n", method, mcpPath, err)
+		return nil
+	}
+	return resp.Result[member]
+}
+
+// GetAllTools returns all tools from all enabled, healthy MCPs, sorted by name
 func (m *MCPManager) GetAllTools() []ToolInfo {
+	return m.collectTools(func(mcpInfo *MCPInfo) bool {
+		return true
+	})
+}
+
+// collectTools returns the namespaced tools of every enabled, healthy MCP
+// accepted by include, sorted by name
+func (m *MCPManager) collectTools(include func(mcpInfo *MCPInfo) bool) []ToolInfo {
 	m.mutex.RLock()
 	defer m.mutex.RUnlock()
 
 	var allTools []ToolInfo
 	for mcpName, mcpInfo := range m.mcpMap {
+		if !m.isEnabled(mcpInfo) || mcpInfo.Health == MCPHealthUnhealthy || !include(mcpInfo) {
+			continue
+		}
 		for _, tool := range mcpInfo.ToolInfos {
 			// Create a copy of the tool with the name prefixed by the MCP name
 			toolCopy := tool
-			toolCopy.Name = fmt.Sprintf("%s.%s", mcpName, tool.Name)
+			toolCopy.Name = mcpName + ToolNameSeparator + tool.Name
+			if !m.toolAllowed(toolCopy.Name) {
+				continue
+			}
+			if alias, ok := m.aliasByTarget[toolCopy.Name]; ok {
+				toolCopy.Name = alias
+			} else if m.passthrough {
+				toolCopy.Name = tool.Name
+			}
 			allTools = append(allTools, toolCopy)
 		}
 	}
+	sort.Slice(allTools, func(i, j int) bool {
+		return allTools[i].Name < allTools[j].Name
+	})
 	return allTools
 }
 
+// networkManifestMCP returns the name and path of the network MCP described
+// by the manifest at manifestPath in the MCP directory root, or false if
+// there is an executable next to it or it doesn't describe a network MCP.
+// The caller must hold the write lock.
+func (m *MCPManager) networkManifestMCP(root, manifestPath string) (string, string, bool) {
+	path := strings.TrimSuffix(manifestPath, manifestSuffix)
+	if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+		return "", "", false
+	}
+
+	name := mcpName(root, path)
+	config, err := m.loadMCPConfig(name, path)
+	if err != nil || config.Endpoint == "" {
+		return "", "", false
+	}
+	return name, path, true
+}
+
+// mcpName returns the name of the MCP at path: its path relative to the MCP
+// directory root without the extension, with each directory separator
+// replaced by ToolNameSeparator, so mcps/math/calc is named "math.calc"
+func mcpName(root, path string) string {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		rel = filepath.Base(path)
+	}
+	rel = strings.TrimSuffix(rel, filepath.Ext(rel))
+	return strings.ReplaceAll(filepath.ToSlash(rel), "/", ToolNameSeparator)
+}
+
+// splitToolNameLocked splits a namespaced tool name into its MCP name and
+// the MCP's own name for the tool. MCP names may themselves contain the
+// separator, so the longest loaded MCP name prefixing the tool name wins;
+// if none matches, the name is split at the first separator. The caller
+// must hold the lock.
+func (m *MCPManager) splitToolNameLocked(toolName string) (string, string, bool) {
+	for i := strings.LastIndex(toolName, ToolNameSeparator); i > 0; i = strings.LastIndex(toolName[:i], ToolNameSeparator) {
+		if _, ok := m.mcpMap[toolName[:i]]; ok {
+			return toolName[:i], toolName[i+len(ToolNameSeparator):], true
+		}
+	}
+	return strings.Cut(toolName, ToolNameSeparator)
+}
+
 // GetMCPForTool returns the MCP info for a given tool name
 func (m *MCPManager) GetMCPForTool(toolName string) (*MCPInfo, string, error) {
 	m.mutex.RLock()
 	defer m.mutex.RUnlock()
 
-	parts := strings.SplitN(toolName, ".", 2)
-	if len(parts) != 2 {
-		return nil, "", fmt.Errorf("invalid tool name format, expected 'mcp.tool': %s", toolName)
+	toolName = m.resolveAlias(toolName)
+	if namespaced, ok := m.passthroughToolLocked(toolName); ok {
+		toolName = namespaced
+	}
+	mcpName, localToolName, ok := m.splitToolNameLocked(toolName)
+	if !ok {
+		return nil, "", fmt.Errorf("%w: %s, expected 'mcp.tool'", ErrToolNotFound, toolName)
 	}
 
-	mcpName := parts[0]
-	localToolName := parts[1]
+	if !m.toolAllowed(toolName) {
+		return nil, "", fmt.Errorf("%w: %s", ErrToolDenied, toolName)
+	}
 
 	mcpInfo, ok := m.mcpMap[mcpName]
 	if !ok {
-		return nil, "", fmt.Errorf("MCP not found: %s", mcpName)
+		return nil, "", fmt.Errorf("%w: %s, no MCP named %s", ErrToolNotFound, toolName, mcpName)
+	}
+	if !m.isEnabled(mcpInfo) {
+		return nil, "", fmt.Errorf("%w: %s is disabled", ErrMCPUnavailable, mcpName)
+	}
+	if mcpInfo.Health == MCPHealthUnhealthy {
+		return nil, "", fmt.Errorf("%w: %s is unhealthy", ErrMCPUnavailable, mcpName)
+	}
+
+	// Reject tools the MCP didn't advertise without starting it
+	if !mcpInfo.hasTool(localToolName) {
+		return nil, "", fmt.Errorf("%w: %s, MCP %s has no tool named %s", ErrToolNotFound, toolName, mcpName, localToolName)
 	}
 
 	return mcpInfo, localToolName, nil
 }
 
-// ExecuteTool executes a tool on the appropriate MCP
-func (m *MCPManager) ExecuteTool(ctx context.Context, toolName string, parameters map[string]interface{}) (interface{}, error) {
+// hasTool reports whether the MCP advertised a tool named localToolName
+// when its tools were last discovered. The caller must hold the lock.
+func (i *MCPInfo) hasTool(localToolName string) bool {
+	for _, tool := range i.ToolInfos {
+		if tool.Name == localToolName {
+			return true
+		}
+	}
+	return false
+}
+
+// ExecuteTool executes a tool on the appropriate MCP. If progressFn is not
+// nil, progress notifications the MCP sends before its result are passed to it.
+func (m *MCPManager) ExecuteTool(ctx context.Context, toolName string, parameters map[string]interface{}, progressFn ProgressFunc) (result *CallToolResult, err error) {
+	ctx, span := tracer.Start(ctx, "execute "+toolName, trace.WithAttributes(attribute.String("mcp.tool", toolName)))
+	defer func() { endSpan(span, err) }()
+
+	if err := m.beginCall(); err != nil {
+		return nil, err
+	}
+	defer m.endCall()
+
 	mcpInfo, localToolName, err := m.GetMCPForTool(toolName)
 	if err != nil {
 		return nil, err
 	}
+	span.SetAttributes(attribute.String("mcp.name", mcpInfo.Name))
+	m.logPayload("Calling %s on MCP %s with arguments: %s\n", parameters, localToolName, mcpInfo.Name)
+	defer func() {
+		if err != nil {
+			m.logPayload("Call to %s on MCP %s failed: %s\n", err.Error(), localToolName, mcpInfo.Name)
+		} else {
+			m.logPayload("Call to %s on MCP %s returned: %s\n", result, localToolName, mcpInfo.Name)
+		}
+	}()
 
-	// Create a command to execute the MCP
-	cmd := exec.CommandContext(ctx, mcpInfo.Path)
-	stdin, err := cmd.StdinPipe()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get stdin pipe: %w", err)
+	// Answer calls of cacheable tools from earlier results when possible
+	key, keyOK := callKey(mcpInfo.Name+"."+localToolName, parameters)
+	cache, ttl := m.resultCacheFor(mcpInfo, localToolName)
+	if cache != nil && keyOK {
+		if cached, ok := cache.get(key); ok {
+			return cached, nil
+		}
 	}
 
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get stdout pipe: %w", err)
+	// Fast-fail calls to an MCP that keeps failing
+	if err := m.allowCall(mcpInfo); err != nil {
+		return nil, err
 	}
 
-	// Start the command
-	if err := cmd.Start(); err != nil {
-		return nil, fmt.Errorf("failed to start MCP: %w", err)
+	// Bound the call by the tool's own timeout or the default for tool
+	// calls; a sooner deadline of the caller still applies. A call that runs
+	// out of its own time is a failure of the MCP, unlike one the caller
+	// gives up on, so the caller's context is kept for the circuit breaker.
+	callerCtx := ctx
+	if timeout := m.callTimeout(mcpInfo, localToolName); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
 	}
 
-	// Ensure the command is killed when done
-	defer cmd.Process.Kill()
+	// Adapt the arguments to what the MCP expects
+	arguments := m.transformArguments(mcpInfo.Name, parameters)
 
-	// Initialize the MCP
-	initMsg := `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocol_version":"2024-11-05"}}`
-	_, err = stdin.Write([]byte(initMsg + "\n"))
-	if err != nil {
-		return nil, fmt.Errorf("failed to send initialize message: %w", err)
+	execute := func(ctx context.Context) (*CallToolResult, error) {
+		if mcpInfo.Config.Persistent {
+			return m.executePersistent(ctx, mcpInfo, localToolName, arguments, progressFn)
+		}
+		return m.executeTool(ctx, mcpInfo, localToolName, arguments, progressFn)
 	}
 
-	// Read the initialize response
-	buffer := make([]byte, 4096)
-	_, err = stdout.Read(buffer)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read initialize response: %w", err)
+	// Share one execution between identical concurrent calls if enabled.
+	// Progress can only be relayed to a single caller.
+	if keyOK && progressFn == nil && m.coalescing() {
+		result, err = m.executeShared(ctx, key, execute)
+	} else {
+		result, err = execute(ctx)
 	}
 
-	// Build the tool call request
-	callParams := map[string]interface{}{
-		"name":      localToolName,
-		"arguments": parameters,
+	var exitErr *ProcessExitError
+	var startErr *StartError
+	switch {
+	case errors.As(err, &startErr):
+		m.logf("warning", "Warning: MCP %s could not be started: %v\n", mcpInfo.Name, startErr.Err)
+	case errors.As(err, &exitErr):
+		m.logf("warning", "Warning: MCP %s failed during a call: %v\n", mcpInfo.Name, exitErr)
 	}
 
-	callRequest := map[string]interface{}{
-		"jsonrpc": "2.0",
-		"id":      2,
-		"method":  "tools/call",
-		"params":  callParams,
+	m.recordCallResult(callerCtx, mcpInfo, err)
+	if cache != nil && keyOK && err == nil && !result.IsError {
+		cache.put(key, result, ttl)
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		err = fmt.Errorf("%w: %w", ErrToolTimeout, err)
 	}
+	return result, err
+}
 
-	callJSON, err := json.Marshal(callRequest)
+// executeTool runs a single tool call against a fresh MCP subprocess
+func (m *MCPManager) executeTool(ctx context.Context, mcpInfo *MCPInfo, localToolName string, parameters map[string]interface{}, progressFn ProgressFunc) (*CallToolResult, error) {
+	session, err := startSession(ctx, m.commandRunner(), m.requestedProtocolVersion(), mcpInfo.Path, mcpInfo.Config)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal tools/call request: %w", err)
+		return nil, err
 	}
+	defer session.kill()
 
-	_, err = stdin.Write(append(callJSON, '\n'))
-	if err != nil {
-		return nil, fmt.Errorf("failed to send tools/call message: %w", err)
+	// Tear down the subprocess as soon as the caller gives up
+	stop := session.watch(ctx)
+	defer stop()
+
+	id, written := session.send("tools/call", toolCallParams(ctx, localToolName, parameters, progressFn))
+
+	// No more requests follow on a one-shot session, and MCPs that read
+	// until EOF only respond once they see it
+	if mcpInfo.Config.closesStdin() {
+		written = session.closeStdinAfter(written)
 	}
 
-	// Read the response
-	n, err := stdout.Read(buffer)
+	// Read the response, relaying progress notifications until it arrives
+	response, err := session.await(ctx, "tools/call", id, written, progressFn)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read tools/call response: %w", err)
+		return nil, err
 	}
 
-	// Parse the JSON-RPC response
+	return parseToolCallResponse(response)
+}
+
+// toolCallParams builds the params of the tools/call request sent to an
+// MCP, passing on the client's progress token when progress is relayed
+func toolCallParams(ctx context.Context, localToolName string, parameters map[string]interface{}, progressFn ProgressFunc) map[string]interface{} {
+	callParams := map[string]interface{}{
+		"name":      localToolName,
+		"arguments": parameters,
+	}
+
+	// Pass the client's progress token on so the MCP reports progress
+	if token := progressTokenFrom(ctx); token != nil && progressFn != nil {
+		callParams["_meta"] = map[string]interface{}{
+			"progressToken": token,
+		}
+	}
+
+	return callParams
+}
+
+// parseToolCallResponse extracts the result of a tools/call response,
+// returning a ToolError if the MCP reported one
+func parseToolCallResponse(response []byte) (*CallToolResult, error) {
 	var resp struct {
-		Result interface{} `json:"result"`
+		Result *CallToolResult `json:"result"`
 		Error  *struct {
 			Code    int    `json:"code"`
 			Message string `json:"message"`
 		} `json:"error,omitempty"`
 	}
 
-	if err := json.Unmarshal(buffer[:n], &resp); err != nil {
-		return nil, fmt.Errorf("failed to parse tools/call response: %w", err)
+	if err := json.Unmarshal(response, &resp); err != nil {
+		return nil, &ProtocolError{Err: fmt.Errorf("failed to parse tools/call response: %w", err)}
 	}
 
 	if resp.Error != nil {
-		return nil, fmt.Errorf("MCP tool error: %s (code %d)", resp.Error.Message, resp.Error.Code)
+		return nil, &ToolError{Code: resp.Error.Code, Message: resp.Error.Message}
+	}
+	if resp.Result == nil {
+		return &CallToolResult{}, nil
 	}
 
 	return resp.Result, nil
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SetPassthrough serves the tools of a lone MCP under their own names,
+// without the MCP name prefix. Loading more than one MCP is then an error.
+func (m *MCPManager) SetPassthrough(enabled bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.passthrough = enabled
+}
+
+// checkPassthroughLocked returns an error if passthrough is enabled but
+// more than one MCP is loaded. The caller must hold the lock.
+func (m *MCPManager) checkPassthroughLocked() error {
+	if !m.passthrough || len(m.mcpMap) <= 1 {
+		return nil
+	}
+
+	names := make([]string, 0, len(m.mcpMap))
+	for name := range m.mcpMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return fmt.Errorf("passthrough mode requires a single MCP, found %d: %s", len(names), strings.Join(names, ", "))
+}
+
+// passthroughToolLocked returns the namespaced name of the lone MCP's tool
+// called toolName in passthrough mode, or false if there is no such tool.
+// The caller must hold the lock.
+func (m *MCPManager) passthroughToolLocked(toolName string) (string, bool) {
+	if !m.passthrough || len(m.mcpMap) != 1 {
+		return "", false
+	}
+	for name := range m.mcpMap {
+		namespaced := name + ToolNameSeparator + toolName
+		if m.hasToolLocked(namespaced) {
+			return namespaced, true
+		}
+	}
+	return "", false
+}
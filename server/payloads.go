@@ -0,0 +1,70 @@
+package server
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// redactedValue replaces the values of redacted keys in logged payloads
+const redactedValue = "***"
+
+// SetPayloadLogging turns logging of tool call payloads on or off. Values
+// under any of redactKeys, matched case-insensitively at any depth, are
+// replaced with "***" in the log.
+func (m *MCPManager) SetPayloadLogging(enabled bool, redactKeys []string) {
+	m.logPayloads = enabled
+	m.redactKeys = make(map[string]bool, len(redactKeys))
+	for _, key := range redactKeys {
+		m.redactKeys[strings.ToLower(key)] = true
+	}
+}
+
+// logPayload logs a tool call payload, if payload logging is enabled. The
+// redacted payload is formatted as JSON and appended to args for format.
+func (m *MCPManager) logPayload(format string, payload interface{}, args ...interface{}) {
+	if !m.logPayloads {
+		return
+	}
+
+	data, err := json.Marshal(m.redact(payload))
+	if err != nil {
+		data = []byte("(unserializable payload)")
+	}
+	m.logf("info", format, append(args, data)...)
+}
+
+// redact returns a copy of value with the values of redacted keys masked
+func (m *MCPManager) redact(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			if m.redactKeys[strings.ToLower(key)] {
+				redacted[key] = redactedValue
+			} else {
+				redacted[key] = m.redact(item)
+			}
+		}
+		return redacted
+	case []interface{}:
+		redacted := make([]interface{}, len(v))
+		for i, item := range v {
+			redacted[i] = m.redact(item)
+		}
+		return redacted
+	case json.RawMessage:
+		var decoded interface{}
+		if err := json.Unmarshal(v, &decoded); err != nil {
+			return string(v)
+		}
+		return m.redact(decoded)
+	case *CallToolResult:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return value
+		}
+		return m.redact(json.RawMessage(data))
+	default:
+		return value
+	}
+}
@@ -0,0 +1,555 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultIdleTimeout is how long a persistent MCP subprocess may go without
+// calls before it is shut down
+const DefaultIdleTimeout = 5 * time.Minute
+
+// persistentShutdownGrace is how long a persistent subprocess has to exit
+// after its stdin is closed before it is killed
+const persistentShutdownGrace = 5 * time.Second
+
+// persistentPingTimeout is how long a persistent subprocess has to answer a
+// health check ping or a change of log level
+const persistentPingTimeout = 5 * time.Second
+
+// Restart supervision of persistent subprocesses that exit unexpectedly:
+// restarts back off exponentially from persistentRestartBackoff up to
+// persistentMaxBackoff, and after persistentMaxRestarts consecutive crashes
+// the MCP is marked unhealthy. A subprocess that ran for at least
+// persistentStableUptime before crashing starts a fresh count.
+const (
+	persistentMaxRestarts    = 5
+	persistentRestartBackoff = time.Second
+	persistentMaxBackoff     = time.Minute
+	persistentStableUptime   = time.Minute
+)
+
+// persistentProcess is a long-lived MCP subprocess that serves tool calls one
+// at a time over a single initialized session
+type persistentProcess struct {
+	mcpInfo *MCPInfo
+	// instance numbers the process among the MCP's instances
+	instance int
+
+	// callMutex serializes calls; the fields below it are guarded by it
+	callMutex sync.Mutex
+	session   *mcpSession
+	startErr  error
+
+	// users and lastUsed are guarded by MCPManager.processMutex, as is
+	// expiresAt, when the subprocess is due to be recycled, zero if it
+	// hasn't started or its lifetime isn't limited
+	users     int
+	lastUsed  time.Time
+	expiresAt time.Time
+
+	// startedAt is when the subprocess was started; it is guarded by
+	// callMutex
+	startedAt time.Time
+
+	// failed is set once the subprocess has exited or a call broke its
+	// session, so it can be checked without waiting for callMutex
+	failed atomic.Bool
+
+	// retired is set once the process has been taken out of service, so its
+	// exit is expected and it isn't restarted
+	retired atomic.Bool
+}
+
+// executePersistent runs a tool call on the MCP's persistent subprocess,
+// starting it first if it isn't running
+func (m *MCPManager) executePersistent(ctx context.Context, mcpInfo *MCPInfo, localToolName string, parameters map[string]interface{}, progressFn ProgressFunc) (*CallToolResult, error) {
+	proc := m.acquireProcess(mcpInfo)
+	defer m.releaseProcess(proc)
+
+	proc.callMutex.Lock()
+	defer proc.callMutex.Unlock()
+
+	if err := m.startProcessLocked(ctx, proc); err != nil {
+		return nil, err
+	}
+
+	result, err := proc.call(ctx, localToolName, parameters, progressFn)
+	var toolErr *ToolError
+	switch {
+	case err == nil || errors.As(err, &toolErr):
+		m.resetCrashes(proc.key())
+	case ctx.Err() == nil && proc.session.hasExited():
+		// The subprocess crashed; its supervisor restarts it
+		proc.failed.Store(true)
+	default:
+		// The session can't be trusted after a failed exchange
+		proc.failed.Store(true)
+		m.discardProcess(proc)
+	}
+	return result, err
+}
+
+// startProcessLocked starts proc's subprocess unless it was already
+// started, returning the error the start failed with, if any. A supervisor
+// restarts the subprocess should it exit unexpectedly. The caller must hold
+// proc.callMutex.
+func (m *MCPManager) startProcessLocked(ctx context.Context, proc *persistentProcess) error {
+	if proc.session != nil || proc.startErr != nil {
+		return proc.startErr
+	}
+
+	mcpInfo := proc.mcpInfo
+	proc.session, proc.startErr = startSession(ctx, m.commandRunner(), m.requestedProtocolVersion(), mcpInfo.Path, mcpInfo.Config)
+	if proc.startErr != nil {
+		proc.failed.Store(true)
+		m.discardProcess(proc)
+		return proc.startErr
+	}
+	proc.startedAt = time.Now()
+	if lifetime := mcpInfo.Config.maxLifetime(); lifetime > 0 {
+		m.processMutex.Lock()
+		proc.expiresAt = proc.startedAt.Add(lifetime)
+		m.processMutex.Unlock()
+	}
+
+	m.logf("info", "Started persistent MCP: %s (%v)\n", proc.key(), proc.session)
+	if level := m.LogLevel(); level != DefaultLogLevel {
+		m.applyLogLevelLocked(proc, level)
+	}
+
+	go m.supervise(proc, proc.session)
+	return nil
+}
+
+// supervise waits for the subprocess of proc to exit and restarts it if the
+// exit wasn't expected
+func (m *MCPManager) supervise(proc *persistentProcess, session *mcpSession) {
+	<-session.exited
+	proc.failed.Store(true)
+
+	// Let a call in flight finish, since it may retire the process
+	proc.callMutex.Lock()
+	uptime := time.Since(proc.startedAt)
+	proc.callMutex.Unlock()
+	if proc.retired.Load() || m.isStopping() {
+		return
+	}
+
+	m.logf("warning", "Warning: Persistent MCP %s exited unexpectedly: %v\n", proc.key(), session.exitErr)
+	m.restartCrashed(proc.mcpInfo, proc.instance, uptime)
+}
+
+// restartCrashed restarts the given persistent subprocess instance of
+// mcpInfo after a crash, backing off between attempts, until it starts or
+// the restart budget is exhausted
+func (m *MCPManager) restartCrashed(mcpInfo *MCPInfo, instance int, uptime time.Duration) {
+	key := instanceKey(mcpInfo.Name, instance)
+	for {
+		crashes := m.recordCrash(key, uptime)
+		if crashes > persistentMaxRestarts {
+			m.logf("warning", "Warning: Persistent MCP %s crashed %d times in a row, marking it unhealthy\n", key, crashes)
+			m.markUnhealthy(mcpInfo)
+			return
+		}
+
+		backoff := persistentRestartBackoff << (crashes - 1)
+		if backoff > persistentMaxBackoff {
+			backoff = persistentMaxBackoff
+		}
+		m.logf("info", "Restarting persistent MCP %s in %v\n", key, backoff)
+		time.Sleep(backoff)
+
+		// Give up if the server is stopping or the MCP was reloaded
+		m.mutex.RLock()
+		current := m.mcpMap[mcpInfo.Name] == mcpInfo
+		m.mutex.RUnlock()
+		if !current || m.isStopping() {
+			return
+		}
+
+		proc := m.acquireInstance(mcpInfo, instance)
+		ctx, cancel := context.WithTimeout(context.Background(), DefaultRequestTimeout)
+		proc.callMutex.Lock()
+		err := m.startProcessLocked(ctx, proc)
+		proc.callMutex.Unlock()
+		cancel()
+		m.releaseProcess(proc)
+		if err == nil {
+			return
+		}
+
+		m.logf("warning", "Warning: Failed to restart persistent MCP %s: %v\n", key, err)
+		uptime = 0
+	}
+}
+
+// recordCrash counts a crash of the subprocess instance with the given key
+// after uptime, returning the number of consecutive crashes
+func (m *MCPManager) recordCrash(key string, uptime time.Duration) int {
+	m.processMutex.Lock()
+	defer m.processMutex.Unlock()
+
+	if uptime >= persistentStableUptime {
+		m.crashes[key] = 0
+	}
+	m.crashes[key]++
+	return m.crashes[key]
+}
+
+// resetCrashes clears the crash count of the subprocess instance with the
+// given key after a successful call
+func (m *MCPManager) resetCrashes(key string) {
+	m.processMutex.Lock()
+	defer m.processMutex.Unlock()
+
+	delete(m.crashes, key)
+}
+
+// markUnhealthy withholds the tools of mcpInfo until a health check finds it
+// working again
+func (m *MCPManager) markUnhealthy(mcpInfo *MCPInfo) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.mcpMap[mcpInfo.Name] == mcpInfo {
+		mcpInfo.Health = MCPHealthUnhealthy
+	}
+}
+
+// isStopping reports whether stopProcesses has been called
+func (m *MCPManager) isStopping() bool {
+	m.processMutex.Lock()
+	defer m.processMutex.Unlock()
+
+	return m.stopping
+}
+
+// stopProcesses shuts down every persistent subprocess, once its calls in
+// flight finish, and keeps crashed ones from being restarted
+func (m *MCPManager) stopProcesses() {
+	m.processMutex.Lock()
+	defer m.processMutex.Unlock()
+
+	m.stopping = true
+	for _, proc := range m.processes {
+		m.retireProcessLocked(proc)
+	}
+}
+
+// instanceKey returns the key the given instance of the named MCP's
+// persistent subprocesses is registered under. The first instance uses the
+// MCP name alone.
+func instanceKey(name string, instance int) string {
+	if instance == 0 {
+		return name
+	}
+	return fmt.Sprintf("%s#%d", name, instance)
+}
+
+// key returns the key proc is registered under
+func (p *persistentProcess) key() string {
+	return instanceKey(p.mcpInfo.Name, p.instance)
+}
+
+// acquireProcess returns a persistent process of the MCP to make a call on,
+// the least busy of its instances, registering a new, not yet started one if
+// that instance isn't running. The process is kept alive until
+// releaseProcess is called.
+func (m *MCPManager) acquireProcess(mcpInfo *MCPInfo) *persistentProcess {
+	m.processMutex.Lock()
+	defer m.processMutex.Unlock()
+
+	return m.acquireInstanceLocked(mcpInfo, m.pickInstanceLocked(mcpInfo))
+}
+
+// acquireInstance is like acquireProcess for the given instance of the MCP
+func (m *MCPManager) acquireInstance(mcpInfo *MCPInfo, instance int) *persistentProcess {
+	m.processMutex.Lock()
+	defer m.processMutex.Unlock()
+
+	return m.acquireInstanceLocked(mcpInfo, instance)
+}
+
+// acquireInstanceLocked implements acquireInstance. The caller must hold
+// processMutex.
+func (m *MCPManager) acquireInstanceLocked(mcpInfo *MCPInfo, instance int) *persistentProcess {
+	key := instanceKey(mcpInfo.Name, instance)
+	proc := m.processes[key]
+	if proc != nil && (proc.mcpInfo != mcpInfo || proc.hasExited()) {
+		// The MCP was reloaded or its subprocess died
+		m.retireProcessLocked(proc)
+		proc = nil
+	}
+	if proc != nil && proc.expiredLocked(time.Now()) {
+		m.recycleProcessLocked(proc)
+		proc = nil
+	}
+	if proc == nil {
+		proc = &persistentProcess{mcpInfo: mcpInfo, instance: instance}
+		m.processes[key] = proc
+	}
+
+	proc.users++
+	proc.lastUsed = time.Now()
+	return proc
+}
+
+// pickInstanceLocked chooses the instance of the MCP with the fewest calls
+// in flight, taking turns between equally busy ones. Instances that aren't
+// running count as idle. The caller must hold processMutex.
+func (m *MCPManager) pickInstanceLocked(mcpInfo *MCPInfo) int {
+	count := mcpInfo.Config.instanceCount()
+	if count == 1 {
+		return 0
+	}
+
+	start := m.nextInstance[mcpInfo.Name] % count
+	m.nextInstance[mcpInfo.Name] = start + 1
+
+	best, bestUsers := 0, -1
+	for i := 0; i < count; i++ {
+		instance := (start + i) % count
+		users := 0
+		if proc := m.processes[instanceKey(mcpInfo.Name, instance)]; proc != nil && proc.mcpInfo == mcpInfo && !proc.hasExited() {
+			users = proc.users
+		}
+		if bestUsers < 0 || users < bestUsers {
+			best, bestUsers = instance, users
+		}
+	}
+	return best
+}
+
+// releaseProcess marks a call to proc as finished, shutting proc down if it
+// was retired while in use
+func (m *MCPManager) releaseProcess(proc *persistentProcess) {
+	m.processMutex.Lock()
+	defer m.processMutex.Unlock()
+
+	proc.users--
+	proc.lastUsed = time.Now()
+	if proc.users == 0 && m.processes[proc.key()] != proc {
+		m.shutdownProcessLocked(proc)
+	}
+}
+
+// discardProcess retires proc so the next call starts a fresh subprocess
+func (m *MCPManager) discardProcess(proc *persistentProcess) {
+	m.processMutex.Lock()
+	defer m.processMutex.Unlock()
+
+	m.retireProcessLocked(proc)
+}
+
+// retireProcessLocked removes proc from the running processes, shutting it
+// down now if it is idle or once its last call finishes otherwise. The
+// caller must hold processMutex.
+func (m *MCPManager) retireProcessLocked(proc *persistentProcess) {
+	proc.retired.Store(true)
+	if m.processes[proc.key()] == proc {
+		delete(m.processes, proc.key())
+	}
+	if proc.users == 0 {
+		m.shutdownProcessLocked(proc)
+	}
+}
+
+// shutdownProcessLocked shuts proc down in the background, tracked so
+// waitForProcesses can wait for it. The caller must hold processMutex.
+func (m *MCPManager) shutdownProcessLocked(proc *persistentProcess) {
+	m.shutdowns.Add(1)
+	go func() {
+		defer m.shutdowns.Done()
+		proc.shutdown()
+	}()
+}
+
+// waitForProcesses waits for the persistent subprocesses being shut down to
+// exit, or ctx to expire
+func (m *MCPManager) waitForProcesses(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		m.shutdowns.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("persistent MCP subprocesses still shutting down: %w", ctx.Err())
+	}
+}
+
+// expiredLocked reports whether the subprocess has outlived its maximum
+// lifetime at now. The caller must hold MCPManager.processMutex.
+func (p *persistentProcess) expiredLocked(now time.Time) bool {
+	return !p.expiresAt.IsZero() && now.After(p.expiresAt)
+}
+
+// recycleProcessLocked retires proc for having outlived its maximum
+// lifetime. Calls in flight on it finish first, while the next call starts a
+// fresh subprocess. The caller must hold processMutex.
+func (m *MCPManager) recycleProcessLocked(proc *persistentProcess) {
+	m.logf("info", "Recycling persistent MCP %s after its maximum lifetime of %v\n", proc.key(), proc.mcpInfo.Config.maxLifetime())
+	m.retireProcessLocked(proc)
+}
+
+// recycleExpiredProcesses retires the persistent subprocesses that have
+// outlived their maximum lifetime, busy or not
+func (m *MCPManager) recycleExpiredProcesses() {
+	m.processMutex.Lock()
+	defer m.processMutex.Unlock()
+
+	now := time.Now()
+	for _, proc := range m.processes {
+		if proc.expiredLocked(now) {
+			m.recycleProcessLocked(proc)
+		}
+	}
+}
+
+// reapIdleProcesses shuts down persistent subprocesses that have had no
+// calls for longer than idleTimeout. Processes with calls in flight are
+// never reaped.
+func (m *MCPManager) reapIdleProcesses(idleTimeout time.Duration) {
+	m.processMutex.Lock()
+	defer m.processMutex.Unlock()
+
+	for _, proc := range m.processes {
+		if proc.users == 0 && time.Since(proc.lastUsed) > idleTimeout {
+			m.logf("info", "Stopping idle MCP: %s\n", proc.key())
+			m.retireProcessLocked(proc)
+		}
+	}
+}
+
+// pingProcesses pings the running persistent subprocesses, discarding any
+// that don't answer so the next call starts a fresh one
+func (m *MCPManager) pingProcesses() {
+	m.processMutex.Lock()
+	procs := make([]*persistentProcess, 0, len(m.processes))
+	for _, proc := range m.processes {
+		procs = append(procs, proc)
+	}
+	m.processMutex.Unlock()
+
+	for _, proc := range procs {
+		if err := proc.ping(); err != nil {
+			m.logf("warning", "Warning: Persistent MCP %s failed ping: %v\n", proc.key(), err)
+			proc.failed.Store(true)
+			m.discardProcess(proc)
+		}
+	}
+}
+
+// StartIdleReaper shuts down persistent MCP subprocesses once they have been
+// idle for idleTimeout, or have outlived their maximum lifetime, checking
+// until ctx is done or the server is closed. They are restarted on their
+// next call.
+func (s *MCPServer) StartIdleReaper(ctx context.Context, idleTimeout time.Duration) {
+	go func() {
+		interval := idleTimeout / 2
+		if interval < time.Second {
+			interval = time.Second
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-s.closed:
+				return
+			case <-ticker.C:
+				s.mcpManager.recycleExpiredProcesses()
+				s.mcpManager.reapIdleProcesses(idleTimeout)
+			}
+		}
+	}()
+}
+
+// call sends a tools/call request over the session and waits for its
+// response. The caller must hold callMutex.
+func (p *persistentProcess) call(ctx context.Context, localToolName string, parameters map[string]interface{}, progressFn ProgressFunc) (*CallToolResult, error) {
+	if p.session.hasExited() {
+		return nil, ErrMCPExited
+	}
+
+	response, err := p.session.request(ctx, "tools/call", toolCallParams(ctx, localToolName, parameters, progressFn), progressFn)
+	if err != nil {
+		if ctx.Err() == nil && p.session.hasExited() {
+			return nil, fmt.Errorf("%w: %w", ErrMCPExited, err)
+		}
+		return nil, err
+	}
+
+	return parseToolCallResponse(response)
+}
+
+// ping checks that the subprocess still answers requests. Any response,
+// even an error from an MCP that doesn't implement ping, counts as alive. A
+// process busy with a call is evidently alive and isn't pinged.
+func (p *persistentProcess) ping() error {
+	if !p.callMutex.TryLock() {
+		return nil
+	}
+	defer p.callMutex.Unlock()
+
+	if p.session == nil {
+		return nil
+	}
+	if p.session.hasExited() {
+		return ErrMCPExited
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), persistentPingTimeout)
+	defer cancel()
+	_, err := p.session.request(ctx, "ping", map[string]interface{}{}, nil)
+	return err
+}
+
+// setProcessLogLevel passes level on to the subprocess of proc, if it is
+// running and its MCP supports logging
+func (m *MCPManager) setProcessLogLevel(proc *persistentProcess, level string) {
+	proc.callMutex.Lock()
+	defer proc.callMutex.Unlock()
+
+	m.applyLogLevelLocked(proc, level)
+}
+
+// applyLogLevelLocked sends level to the subprocess of proc. The caller must
+// hold proc.callMutex.
+func (m *MCPManager) applyLogLevelLocked(proc *persistentProcess, level string) {
+	if proc.session == nil || !proc.session.supportsLogging || proc.hasExited() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), persistentPingTimeout)
+	defer cancel()
+	params := map[string]interface{}{"level": level}
+	if _, err := proc.session.request(ctx, "logging/setLevel", params, nil); err != nil {
+		m.logf("warning", "Warning: Failed to set log level of MCP %s: %v\n", proc.mcpInfo.Name, err)
+	}
+}
+
+// hasExited reports whether the process can no longer serve calls
+func (p *persistentProcess) hasExited() bool {
+	return p.failed.Load()
+}
+
+// shutdown gracefully stops the subprocess, if it was started
+func (p *persistentProcess) shutdown() {
+	p.callMutex.Lock()
+	defer p.callMutex.Unlock()
+
+	if p.session != nil {
+		p.session.shutdown(persistentShutdownGrace)
+	}
+}
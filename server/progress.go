@@ -0,0 +1,81 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// ProgressFunc receives the notifications/progress and notifications/message
+// messages emitted by an MCP while it is executing a tool call
+type ProgressFunc func(notification []byte)
+
+// progressTokenKey is the context key for a client's progress token
+type progressTokenKey struct{}
+
+// withProgressToken returns a context carrying the progress token a client
+// supplied with its tools/call request, so it can be passed on to the MCP
+func withProgressToken(ctx context.Context, token interface{}) context.Context {
+	if token == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, progressTokenKey{}, token)
+}
+
+// progressTokenFrom returns the progress token stored in ctx, if any
+func progressTokenFrom(ctx context.Context) interface{} {
+	return ctx.Value(progressTokenKey{})
+}
+
+// readResponse reads JSON-RPC messages with next until the response with the
+// given id arrives, handing any progress and log notifications read along the
+// way to progressFn. Other messages are discarded.
+func readResponse(next func() ([]byte, error), id int, progressFn ProgressFunc) ([]byte, error) {
+	wantID := strconv.Itoa(id)
+
+	for {
+		line, err := next()
+		line = bytes.TrimSpace(line)
+		if len(line) > 0 {
+			var message struct {
+				ID     json.RawMessage `json:"id"`
+				Method string          `json:"method"`
+			}
+			if json.Unmarshal(line, &message) == nil {
+				if message.Method == "" && string(bytes.TrimSpace(message.ID)) == wantID {
+					return line, nil
+				}
+				relayed := message.Method == "notifications/progress" || message.Method == "notifications/message"
+				if relayed && progressFn != nil {
+					progressFn(line)
+				}
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// errMCPMessageTooLarge is returned when an MCP writes a message over the limit
+var errMCPMessageTooLarge = errors.New("MCP message exceeds maximum size")
+
+// readLine reads up to and including the next newline, failing once the line
+// grows past maxSize bytes instead of buffering it all
+func readLine(reader *bufio.Reader, maxSize int) ([]byte, error) {
+	var line []byte
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if len(line)+len(chunk) > maxSize {
+			return nil, &ProtocolError{Err: fmt.Errorf("%w (%d bytes)", errMCPMessageTooLarge, maxSize)}
+		}
+		line = append(line, chunk...)
+		if err != bufio.ErrBufferFull {
+			return line, err
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"encoding/json"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// DefaultProtocolVersion is the MCP protocol version requested from MCPs
+// unless configured otherwise, the same version the server speaks to its
+// own clients
+const DefaultProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
+
+// SetProtocolVersion sets the protocol version requested from MCPs in the
+// initialize handshake. An empty version restores the default.
+func (m *MCPManager) SetProtocolVersion(version string) {
+	if version == "" {
+		version = DefaultProtocolVersion
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.protocolVersion = version
+}
+
+// requestedProtocolVersion returns the protocol version requested from MCPs
+func (m *MCPManager) requestedProtocolVersion() string {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.protocolVersion
+}
+
+// offeredProtocolVersion returns the protocol version an MCP offers in
+// place of the requested one when its initialize response is an error, as
+// either the "protocolVersion" or the first of the "supported" versions in
+// the error data. It returns "" if there is no such offer.
+func offeredProtocolVersion(response []byte) string {
+	var resp struct {
+		Error *struct {
+			Data struct {
+				ProtocolVersion string   `json:"protocolVersion"`
+				Supported       []string `json:"supported"`
+			} `json:"data"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(response, &resp) != nil || resp.Error == nil {
+		return ""
+	}
+	if resp.Error.Data.ProtocolVersion != "" {
+		return resp.Error.Data.ProtocolVersion
+	}
+	if len(resp.Error.Data.Supported) > 0 {
+		return resp.Error.Data.Supported[0]
+	}
+	return ""
+}
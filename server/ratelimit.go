@@ -0,0 +1,101 @@
+package server
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// rateLimitIdleTimeout is how long a client's bucket is kept after its last
+// request; a client returning later starts with a full bucket
+const rateLimitIdleTimeout = 10 * time.Minute
+
+// clientLimiter rate limits requests with a token bucket per client IP
+type clientLimiter struct {
+	limit rate.Limit
+	burst int
+
+	mutex     sync.Mutex
+	buckets   map[string]*clientBucket
+	lastSweep time.Time
+}
+
+// clientBucket is the token bucket of one client
+type clientBucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// newClientLimiter creates a limiter allowing each client requestsPerSecond
+// requests on average, in bursts of up to burst
+func newClientLimiter(requestsPerSecond float64, burst int) *clientLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &clientLimiter{
+		limit:     rate.Limit(requestsPerSecond),
+		burst:     burst,
+		buckets:   make(map[string]*clientBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// reserve takes a token from the client's bucket, returning how long the
+// client must wait before retrying if none is available
+func (l *clientLimiter) reserve(client string) (time.Duration, bool) {
+	now := time.Now()
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	// Evict buckets of clients that have gone quiet
+	if now.Sub(l.lastSweep) > rateLimitIdleTimeout {
+		for key, bucket := range l.buckets {
+			if now.Sub(bucket.lastSeen) > rateLimitIdleTimeout {
+				delete(l.buckets, key)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	bucket := l.buckets[client]
+	if bucket == nil {
+		bucket = &clientBucket{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.buckets[client] = bucket
+	}
+	bucket.lastSeen = now
+
+	reservation := bucket.limiter.ReserveN(now, 1)
+	if delay := reservation.DelayFrom(now); delay > 0 {
+		reservation.CancelAt(now)
+		return delay, false
+	}
+	return 0, true
+}
+
+// wrap rejects requests from clients over their rate with 429 Too Many
+// Requests and a Retry-After header
+func (l *clientLimiter) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if delay, ok := l.reserve(clientIP(r)); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientIP returns the IP address a request came from
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
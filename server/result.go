@@ -0,0 +1,157 @@
+package server
+
+import (
+	"encoding/json"
+)
+
+// CallToolResult is the result of a tools/call request, mirroring MCP's
+// CallToolResult. Fields it doesn't model, such as structuredContent and
+// _meta, are kept in Extra so they pass through unchanged.
+type CallToolResult struct {
+	Content []Content `json:"content"`
+	IsError bool      `json:"isError,omitempty"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// Content is a content block of a tool result: text, an image or audio
+// clip, an embedded resource, or a kind this server doesn't know, whose
+// fields are kept in Extra
+type Content struct {
+	Type string `json:"type"`
+	// Text is the text of a text block
+	Text string `json:"text,omitempty"`
+	// Data is the base64-encoded data of an image or audio block. It is
+	// kept encoded so it is passed on byte for byte.
+	Data     string `json:"data,omitempty"`
+	MimeType string `json:"mimeType,omitempty"`
+	// Resource is the resource of a resource block
+	Resource    *ResourceContents `json:"resource,omitempty"`
+	Annotations json.RawMessage   `json:"annotations,omitempty"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// ResourceContents is the contents of an embedded resource, either text or
+// a base64-encoded blob
+type ResourceContents struct {
+	URI      string `json:"uri"`
+	MimeType string `json:"mimeType,omitempty"`
+	Text     string `json:"text,omitempty"`
+	Blob     string `json:"blob,omitempty"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (r *CallToolResult) UnmarshalJSON(data []byte) error {
+	type plain CallToolResult
+	extra, err := unmarshalWithExtra(data, (*plain)(r), "content", "isError")
+	r.Extra = extra
+	return err
+}
+
+// MarshalJSON implements json.Marshaler. A missing content array is written
+// as an empty one, since clients require it.
+func (r CallToolResult) MarshalJSON() ([]byte, error) {
+	type plain CallToolResult
+	if r.Content == nil {
+		r.Content = []Content{}
+	}
+	return marshalWithExtra(plain(r), r.Extra, nil)
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (c *Content) UnmarshalJSON(data []byte) error {
+	type plain Content
+	extra, err := unmarshalWithExtra(data, (*plain)(c), "type", "text", "data", "mimeType", "resource", "annotations")
+	c.Extra = extra
+	return err
+}
+
+// MarshalJSON implements json.Marshaler. The fields a block's type
+// requires are written even when empty.
+func (c Content) MarshalJSON() ([]byte, error) {
+	type plain Content
+	required := map[string]interface{}{}
+	switch c.Type {
+	case "text":
+		required["text"] = c.Text
+	case "image", "audio":
+		required["data"] = c.Data
+		required["mimeType"] = c.MimeType
+	}
+	return marshalWithExtra(plain(c), c.Extra, required)
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (r *ResourceContents) UnmarshalJSON(data []byte) error {
+	type plain ResourceContents
+	extra, err := unmarshalWithExtra(data, (*plain)(r), "uri", "mimeType", "text", "blob")
+	r.Extra = extra
+	return err
+}
+
+// MarshalJSON implements json.Marshaler. A resource without a blob is a
+// text resource, whose text is written even when empty.
+func (r ResourceContents) MarshalJSON() ([]byte, error) {
+	type plain ResourceContents
+	required := map[string]interface{}{}
+	if r.Blob == "" {
+		required["text"] = r.Text
+	}
+	return marshalWithExtra(plain(r), r.Extra, required)
+}
+
+// unmarshalWithExtra decodes data, a JSON object, into v and returns the
+// members whose keys aren't among known
+func unmarshalWithExtra(data []byte, v interface{}, known ...string) (map[string]json.RawMessage, error) {
+	if err := json.Unmarshal(data, v); err != nil {
+		return nil, err
+	}
+
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(data, &members); err != nil {
+		return nil, err
+	}
+	for _, key := range known {
+		delete(members, key)
+	}
+	if len(members) == 0 {
+		return nil, nil
+	}
+	return members, nil
+}
+
+// marshalWithExtra encodes v, a struct without custom marshaling, as a JSON
+// object together with the members of extra and required, which are
+// written even if v omitted them as empty
+func marshalWithExtra(v interface{}, extra map[string]json.RawMessage, required map[string]interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if len(extra) == 0 && len(required) == 0 {
+		return data, nil
+	}
+
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(data, &members); err != nil {
+		return nil, err
+	}
+	for key, value := range required {
+		if _, ok := members[key]; !ok {
+			raw, err := json.Marshal(value)
+			if err != nil {
+				return nil, err
+			}
+			members[key] = raw
+		}
+	}
+	for key, value := range extra {
+		if _, ok := members[key]; !ok {
+			members[key] = value
+		}
+	}
+	return json.Marshal(members)
+}
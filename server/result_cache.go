@@ -0,0 +1,154 @@
+package server
+
+import (
+	"container/list"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultResultCacheSize is the default number of tool results cached
+const DefaultResultCacheSize = 1000
+
+// defaultResultCacheTTL is how long a cacheable tool's results are kept
+// when its configuration doesn't say
+const defaultResultCacheTTL = time.Minute
+
+// resultCacheEntry is a cached tool result and when it expires
+type resultCacheEntry struct {
+	key     string
+	result  *CallToolResult
+	expires time.Time
+}
+
+// resultCache is a bounded in-memory cache of the results of cacheable
+// tools, evicting the least recently used entry once full
+type resultCache struct {
+	size    int
+	entries map[string]*list.Element
+	order   *list.List
+	mutex   sync.Mutex
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+// newResultCache creates a cache holding at most size results
+func newResultCache(size int) *resultCache {
+	return &resultCache{
+		size:    size,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// get returns the unexpired result cached under key, counting the lookup
+// as a hit or a miss
+func (c *resultCache) get(key string) (*CallToolResult, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	element, ok := c.entries[key]
+	if ok {
+		entry := element.Value.(*resultCacheEntry)
+		if time.Now().Before(entry.expires) {
+			c.order.MoveToFront(element)
+			c.hits.Add(1)
+			return entry.result, true
+		}
+		c.order.Remove(element)
+		delete(c.entries, key)
+	}
+
+	c.misses.Add(1)
+	return nil, false
+}
+
+// put caches result under key for ttl, evicting the least recently used
+// results to stay within the size
+func (c *resultCache) put(key string, result *CallToolResult, ttl time.Duration) {
+	if c.size <= 0 {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry := &resultCacheEntry{key: key, result: result, expires: time.Now().Add(ttl)}
+	if element, ok := c.entries[key]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(entry)
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*resultCacheEntry).key)
+	}
+}
+
+// len returns the number of cached results, including expired ones not
+// yet evicted
+func (c *resultCache) len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.order.Len()
+}
+
+// SetResultCacheSize bounds the number of tool results cached for tools
+// marked cacheable. A size of zero disables the cache.
+func (m *MCPManager) SetResultCacheSize(size int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.results = newResultCache(size)
+}
+
+// resultCacheFor returns the cache and TTL for results of the tool named
+// localToolName, or nil if its results aren't cached
+func (m *MCPManager) resultCacheFor(mcpInfo *MCPInfo, localToolName string) (*resultCache, time.Duration) {
+	tool, ok := mcpInfo.Config.Tools[localToolName]
+	if !ok || !tool.Cacheable {
+		return nil, 0
+	}
+
+	m.mutex.RLock()
+	cache := m.results
+	m.mutex.RUnlock()
+	if cache == nil || cache.size <= 0 {
+		return nil, 0
+	}
+
+	ttl := defaultResultCacheTTL
+	if tool.CacheTTLSeconds > 0 {
+		ttl = time.Duration(tool.CacheTTLSeconds) * time.Second
+	}
+	return cache, ttl
+}
+
+// handleMetrics reports the server's counters in the Prometheus text format
+func (s *MCPServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	s.mcpManager.mutex.RLock()
+	cache := s.mcpManager.results
+	s.mcpManager.mutex.RUnlock()
+
+	var hits, misses int64
+	var entries int
+	if cache != nil {
+		hits, misses, entries = cache.hits.Load(), cache.misses.Load(), cache.len()
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintf(w, "# HELP mcp_result_cache_hits_total Tool calls answered from the result cache.\n")
+	fmt.Fprintf(w, "# TYPE mcp_result_cache_hits_total counter\n")
+	fmt.Fprintf(w, "mcp_result_cache_hits_total %d\n", hits)
+	fmt.Fprintf(w, "# HELP mcp_result_cache_misses_total Calls of cacheable tools not found in the result cache.\n")
+	fmt.Fprintf(w, "# TYPE mcp_result_cache_misses_total counter\n")
+	fmt.Fprintf(w, "mcp_result_cache_misses_total %d\n", misses)
+	fmt.Fprintf(w, "# HELP mcp_result_cache_entries Tool results currently cached.\n")
+	fmt.Fprintf(w, "# TYPE mcp_result_cache_entries gauge\n")
+	fmt.Fprintf(w, "mcp_result_cache_entries %d\n", entries)
+}
@@ -0,0 +1,42 @@
+//go:build linux
+
+package server
+
+import (
+	"fmt"
+	"strings"
+)
+
+// limitedArgs wraps the command line args in a shell that sets the
+// configured rlimits on itself and then execs the MCP, so the limits are in
+// force before the MCP runs. Go cannot run setrlimit between fork and exec,
+// and applying them with prlimit once the process has started would leave
+// it running unlimited for a moment.
+func limitedArgs(args []string, limits ResourceLimits) ([]string, error) {
+	if !limits.isSet() {
+		return args, nil
+	}
+
+	// ulimit -v counts KiB
+	memoryKiB := limits.MaxMemoryBytes / 1024
+	if limits.MaxMemoryBytes > 0 && memoryKiB == 0 {
+		memoryKiB = 1
+	}
+
+	var script []string
+	for _, limit := range []struct {
+		flag  string
+		value uint64
+	}{
+		{"-v", memoryKiB},
+		{"-t", limits.MaxCPUSeconds},
+		{"-n", limits.MaxOpenFiles},
+	} {
+		if limit.value != 0 {
+			script = append(script, fmt.Sprintf("ulimit %s %d", limit.flag, limit.value))
+		}
+	}
+	script = append(script, `exec "$0" "$@"`)
+
+	return append([]string{"/bin/sh", "-c", strings.Join(script, " && ")}, args...), nil
+}
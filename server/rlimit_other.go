@@ -0,0 +1,14 @@
+//go:build !linux
+
+package server
+
+import "errors"
+
+// limitedArgs fails if any limit is configured, since rlimits are only
+// applied on Linux
+func limitedArgs(args []string, limits ResourceLimits) ([]string, error) {
+	if limits.isSet() {
+		return nil, errors.New("resource limits are only supported on Linux")
+	}
+	return args, nil
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Ways of resolving an MCP name found under more than one MCP directory
+const (
+	// DirConflictOverride serves the MCP from the directory listed last,
+	// the default
+	DirConflictOverride = "override"
+	// DirConflictError loads the MCP from the directory listed first and
+	// reports the others as load errors
+	DirConflictError = "error"
+)
+
+// SetMCPDirectories replaces the directories scanned for MCPs on the next
+// load. They are scanned in order, and an MCP name found under more than
+// one of them is resolved as set by SetDirectoryConflicts.
+func (m *MCPManager) SetMCPDirectories(dirs []string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.mcpDirectories = append([]string{}, dirs...)
+}
+
+// SetDirectoryConflicts sets how an MCP name found under more than one MCP
+// directory is resolved, DirConflictOverride or DirConflictError
+func (m *MCPManager) SetDirectoryConflicts(mode string) error {
+	if mode != DirConflictOverride && mode != DirConflictError {
+		return fmt.Errorf("invalid directory conflict mode %q, expected %s or %s", mode, DirConflictOverride, DirConflictError)
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.dirConflicts = mode
+	return nil
+}
+
+// claimMCPName records that the MCP named name was found at path, returning
+// false if an MCP of that name was found before, in which case the one at
+// path is not loaded. found holds the paths of the MCPs found so far by
+// name. The caller must hold the write lock.
+func (m *MCPManager) claimMCPName(found map[string]string, name, path string) bool {
+	first, ok := found[name]
+	if !ok {
+		found[name] = path
+		return true
+	}
+
+	if m.dirConflicts == DirConflictError {
+		m.recordLoadError(path, fmt.Errorf("MCP %s is also found at %s", name, first))
+	} else {
+		m.logf("info", "MCP %s at %s is overridden by %s\n", name, path, first)
+	}
+	return false
+}
+
+// mcpRoot returns the MCP directory that path is inside of, the innermost
+// one if they are nested, or false if it is inside none of them. The caller
+// must hold the lock.
+func (m *MCPManager) mcpRoot(path string) (string, bool) {
+	best, found := "", false
+	for _, root := range m.mcpDirectories {
+		rel, err := filepath.Rel(root, path)
+		if err != nil || rel == ".." || strings.HasPrefix(filepath.ToSlash(rel), "../") {
+			continue
+		}
+		if !found || len(root) > len(best) {
+			best, found = root, true
+		}
+	}
+	return best, found
+}
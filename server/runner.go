@@ -0,0 +1,149 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+)
+
+// CommandRunner starts the subprocesses MCPs run in. The default runner
+// starts operating system processes; tests can inject a fake that answers
+// with canned JSON-RPC responses.
+type CommandRunner interface {
+	// Start starts the MCP at mcpPath with the given configuration
+	Start(mcpPath string, config MCPConfig) (MCPProcess, error)
+}
+
+// MCPProcess is a started MCP subprocess, which exchanges newline-delimited
+// JSON-RPC over its stdin and stdout
+type MCPProcess interface {
+	Stdin() io.WriteCloser
+	Stdout() io.ReadCloser
+	// Wait waits for the subprocess to exit and describes how it ended. It
+	// is called exactly once.
+	Wait() *ProcessExitError
+	// Kill stops the subprocess immediately
+	Kill()
+	// Pid identifies the subprocess in logs
+	Pid() int
+}
+
+// SetCommandRunner replaces the runner that starts MCP subprocesses
+func (m *MCPManager) SetCommandRunner(runner CommandRunner) {
+	m.runnerMutex.Lock()
+	defer m.runnerMutex.Unlock()
+	m.runner = runner
+}
+
+// commandRunner returns the runner that starts MCP subprocesses
+func (m *MCPManager) commandRunner() CommandRunner {
+	m.runnerMutex.RLock()
+	defer m.runnerMutex.RUnlock()
+	return m.runner
+}
+
+// stderrProcess is an MCPProcess whose stderr can be read, as the default
+// runner provides for MCPs configured with stderrResponses
+type stderrProcess interface {
+	// Stderr returns the subprocess's stderr, or nil if it isn't captured
+	Stderr() io.ReadCloser
+}
+
+// execRunner is the default CommandRunner, which runs MCPs as operating
+// system processes
+type execRunner struct{}
+
+// execProcess is an MCP subprocess started by execRunner
+type execProcess struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout io.ReadCloser
+	stderr io.ReadCloser
+}
+
+// Start implements CommandRunner
+func (execRunner) Start(mcpPath string, config MCPConfig) (MCPProcess, error) {
+	cmd, err := newMCPCommand(mcpPath, config)
+	if err != nil {
+		return nil, err
+	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stdin pipe: %w", err)
+	}
+
+	// Use a pipe of our own for stdout, since Wait closes the pipes it
+	// creates and output written just before the subprocess exits would be
+	// lost
+	stdout, stdoutWriter, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stdout pipe: %w", err)
+	}
+	cmd.Stdout = stdoutWriter
+
+	// Capture stderr only for MCPs that may answer there; otherwise it is
+	// discarded
+	var stderr, stderrWriter *os.File
+	if config.StderrResponses {
+		stderr, stderrWriter, err = os.Pipe()
+		if err != nil {
+			stdin.Close()
+			stdout.Close()
+			stdoutWriter.Close()
+			return nil, fmt.Errorf("failed to get stderr pipe: %w", err)
+		}
+		cmd.Stderr = stderrWriter
+	}
+
+	err = cmd.Start()
+	stdoutWriter.Close()
+	if stderrWriter != nil {
+		stderrWriter.Close()
+	}
+	if err != nil {
+		stdin.Close()
+		stdout.Close()
+		if stderr != nil {
+			stderr.Close()
+		}
+		return nil, err
+	}
+
+	process := &execProcess{cmd: cmd, stdin: stdin, stdout: stdout}
+	if stderr != nil {
+		process.stderr = stderr
+	}
+	return process, nil
+}
+
+// Stdin implements MCPProcess
+func (p *execProcess) Stdin() io.WriteCloser {
+	return p.stdin
+}
+
+// Stdout implements MCPProcess
+func (p *execProcess) Stdout() io.ReadCloser {
+	return p.stdout
+}
+
+// Stderr implements stderrProcess
+func (p *execProcess) Stderr() io.ReadCloser {
+	return p.stderr
+}
+
+// Wait implements MCPProcess
+func (p *execProcess) Wait() *ProcessExitError {
+	p.cmd.Wait()
+	return newProcessExitError(p.cmd.ProcessState)
+}
+
+// Kill implements MCPProcess
+func (p *execProcess) Kill() {
+	killProcess(p.cmd)
+}
+
+// Pid implements MCPProcess
+func (p *execProcess) Pid() int {
+	return p.cmd.Process.Pid
+}
@@ -0,0 +1,397 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// fakeProgram stands in for an MCP subprocess started by fakeRunner. It
+// reads stdin and writes stdout as the MCP would, and returns how the
+// subprocess ended.
+type fakeProgram func(stdin *bufio.Reader, stdout io.Writer) *ProcessExitError
+
+// fakeRunner is a CommandRunner that runs its program in a goroutine
+// instead of starting a subprocess
+type fakeRunner struct {
+	program fakeProgram
+}
+
+// Start implements CommandRunner
+func (r fakeRunner) Start(mcpPath string, config MCPConfig) (MCPProcess, error) {
+	return startFakeProcess(r.program), nil
+}
+
+// fakeProcess is an MCPProcess whose stdin and stdout are pipes to a
+// fakeProgram
+type fakeProcess struct {
+	stdinReader  *io.PipeReader
+	stdinWriter  *io.PipeWriter
+	stdoutReader *io.PipeReader
+	stdoutWriter *io.PipeWriter
+
+	// exited is closed once the program has returned, after exitErr is set
+	exited  chan struct{}
+	exitErr *ProcessExitError
+	killed  atomic.Bool
+}
+
+// startFakeProcess runs program as a fake subprocess
+func startFakeProcess(program fakeProgram) *fakeProcess {
+	p := &fakeProcess{exited: make(chan struct{})}
+	p.stdinReader, p.stdinWriter = io.Pipe()
+	p.stdoutReader, p.stdoutWriter = io.Pipe()
+
+	go func() {
+		exitErr := program(bufio.NewReader(p.stdinReader), p.stdoutWriter)
+		if p.killed.Load() {
+			exitErr = &ProcessExitError{ExitCode: -1, Signal: os.Kill}
+		}
+		// Like an exited process, stop reading stdin and close stdout
+		p.stdinReader.CloseWithError(syscall.EPIPE)
+		p.stdoutWriter.Close()
+		p.exitErr = exitErr
+		close(p.exited)
+	}()
+	return p
+}
+
+// Stdin implements MCPProcess
+func (p *fakeProcess) Stdin() io.WriteCloser {
+	return p.stdinWriter
+}
+
+// Stdout implements MCPProcess
+func (p *fakeProcess) Stdout() io.ReadCloser {
+	return p.stdoutReader
+}
+
+// Wait implements MCPProcess
+func (p *fakeProcess) Wait() *ProcessExitError {
+	<-p.exited
+	return p.exitErr
+}
+
+// Kill implements MCPProcess, failing the program's reads and writes so it
+// returns
+func (p *fakeProcess) Kill() {
+	p.killed.Store(true)
+	p.stdinReader.CloseWithError(syscall.EPIPE)
+	p.stdoutWriter.CloseWithError(io.ErrClosedPipe)
+}
+
+// Pid implements MCPProcess
+func (p *fakeProcess) Pid() int {
+	return 0
+}
+
+// rpcMessage is a JSON-RPC message read by a fake program
+type rpcMessage struct {
+	ID     json.RawMessage `json:"id,omitempty"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// serveRPC returns a program that reads newline-delimited JSON-RPC and
+// answers each message with the members handle returns, such as "result",
+// or not at all if it returns nil. The program exits with status 0 at the
+// end of stdin.
+func serveRPC(handle func(message rpcMessage) map[string]interface{}) fakeProgram {
+	return func(stdin *bufio.Reader, stdout io.Writer) *ProcessExitError {
+		for {
+			line, err := stdin.ReadBytes('\n')
+			if line = bytes.TrimSpace(line); len(line) > 0 {
+				var message rpcMessage
+				if json.Unmarshal(line, &message) != nil {
+					return &ProcessExitError{ExitCode: 2}
+				}
+				if reply := handle(message); reply != nil {
+					if err := writeReply(stdout, message, reply); err != nil {
+						return &ProcessExitError{ExitCode: 1}
+					}
+				}
+			}
+			if err != nil {
+				return &ProcessExitError{ExitCode: 0}
+			}
+		}
+	}
+}
+
+// writeReply writes the reply of a fake MCP to message, adding the JSON-RPC
+// version and the message's id to its members
+func writeReply(stdout io.Writer, message rpcMessage, reply map[string]interface{}) error {
+	reply["jsonrpc"] = "2.0"
+	reply["id"] = message.ID
+	data, err := json.Marshal(reply)
+	if err != nil {
+		return err
+	}
+	_, err = stdout.Write(append(data, '\n'))
+	return err
+}
+
+// initializeReply is the reply of a fake MCP to initialize
+func initializeReply() map[string]interface{} {
+	return map[string]interface{}{
+		"result": map[string]interface{}{
+			"protocolVersion": DefaultProtocolVersion,
+			"capabilities":    map[string]interface{}{"tools": map[string]interface{}{}},
+			"serverInfo":      map[string]interface{}{"name": "fake", "version": "1.0"},
+		},
+	}
+}
+
+// errorReply is the reply of a fake MCP rejecting a request
+func errorReply(code int, message string) map[string]interface{} {
+	return map[string]interface{}{
+		"error": map[string]interface{}{"code": code, "message": message},
+	}
+}
+
+// echoToolsReply is the reply of the fake echo MCP to tools/list
+func echoToolsReply() map[string]interface{} {
+	return map[string]interface{}{
+		"result": map[string]interface{}{
+			"tools": []map[string]interface{}{
+				{"name": "say", "description": "Repeat the text"},
+			},
+		},
+	}
+}
+
+// echoMCP answers tools/call by repeating the text argument
+func echoMCP(message rpcMessage) map[string]interface{} {
+	switch message.Method {
+	case "initialize":
+		return initializeReply()
+	case "tools/list":
+		return echoToolsReply()
+	case "tools/call":
+		var params struct {
+			Arguments struct {
+				Text string `json:"text"`
+			} `json:"arguments"`
+		}
+		json.Unmarshal(message.Params, &params)
+		return map[string]interface{}{
+			"result": map[string]interface{}{
+				"content": []map[string]interface{}{{"type": "text", "text": params.Arguments.Text}},
+			},
+		}
+	case "notifications/initialized":
+		return nil
+	}
+	return errorReply(-32601, "method not found")
+}
+
+// newFakeServer returns a server with opts that loads a single MCP named
+// echo, run by program
+func newFakeServer(t *testing.T, program fakeProgram, opts ...ServerOption) *MCPServer {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "echo"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewMCPServer(dir, "test", "1.0", append([]ServerOption{WithCommandRunner(fakeRunner{program: program})}, opts...)...)
+	if err != nil {
+		t.Fatalf("NewMCPServer: %v", err)
+	}
+	return s
+}
+
+func TestFakeRunnerDiscovery(t *testing.T) {
+	s := newFakeServer(t, serveRPC(echoMCP))
+
+	tools := s.mcpManager.GetAllTools()
+	if len(tools) != 1 || tools[0].Name != "echo"+ToolNameSeparator+"say" || tools[0].Description != "Repeat the text" {
+		t.Fatalf("tools = %+v, want echo.say", tools)
+	}
+
+	summaries := s.mcpManager.GetMCPSummaries()
+	if len(summaries) != 1 || summaries[0].Status != MCPStatusLoaded || summaries[0].ServerName != "fake" {
+		t.Fatalf("summaries = %+v, want a loaded MCP named fake", summaries)
+	}
+}
+
+func TestFakeRunnerToolCall(t *testing.T) {
+	s := newFakeServer(t, serveRPC(echoMCP))
+
+	result, err := s.mcpManager.ExecuteTool(context.Background(), "echo"+ToolNameSeparator+"say", map[string]interface{}{"text": "hello"}, nil)
+	if err != nil {
+		t.Fatalf("ExecuteTool: %v", err)
+	}
+	if result.IsError || len(result.Content) != 1 || result.Content[0].Text != "hello" {
+		t.Fatalf("result = %+v, want the text hello", result)
+	}
+}
+
+func TestFakeRunnerCrash(t *testing.T) {
+	tests := []struct {
+		name string
+		// crashOn is the method the MCP exits instead of answering
+		crashOn    string
+		wantStatus string
+	}{
+		{name: "during discovery", crashOn: "tools/list", wantStatus: MCPStatusFailed},
+		{name: "during a call", crashOn: "tools/call", wantStatus: MCPStatusLoaded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			program := handshakeThen(func(stdin *bufio.Reader, stdout io.Writer) *ProcessExitError {
+				for {
+					line, err := stdin.ReadBytes('\n')
+					var message rpcMessage
+					if json.Unmarshal(line, &message) == nil {
+						if message.Method == tt.crashOn {
+							return &ProcessExitError{ExitCode: 2}
+						}
+						if reply := echoMCP(message); reply != nil {
+							writeReply(stdout, message, reply)
+						}
+					}
+					if err != nil {
+						return &ProcessExitError{ExitCode: 0}
+					}
+				}
+			})
+			s := newFakeServer(t, program)
+
+			summaries := s.mcpManager.GetMCPSummaries()
+			if len(summaries) != 1 || summaries[0].Status != tt.wantStatus {
+				t.Fatalf("summaries = %+v, want status %s", summaries, tt.wantStatus)
+			}
+			if tt.wantStatus == MCPStatusFailed {
+				if errs := s.mcpManager.LoadErrors(); len(errs) != 1 {
+					t.Fatalf("load errors = %+v, want one", errs)
+				}
+				return
+			}
+
+			_, err := s.mcpManager.ExecuteTool(context.Background(), "echo"+ToolNameSeparator+"say", map[string]interface{}{"text": "hello"}, nil)
+			var exitErr *ProcessExitError
+			if !errors.As(err, &exitErr) || exitErr.ExitCode != 2 {
+				t.Fatalf("error = %v, want exit code 2", err)
+			}
+		})
+	}
+}
+
+func TestCallsDuringReload(t *testing.T) {
+	// While slow is set, discovery waits for release
+	var slow atomic.Bool
+	discovering := make(chan struct{}, 1)
+	release := make(chan struct{})
+	s := newFakeServer(t, serveRPC(func(message rpcMessage) map[string]interface{} {
+		if message.Method == "tools/list" && slow.Load() {
+			discovering <- struct{}{}
+			<-release
+		}
+		return echoMCP(message)
+	}))
+
+	slow.Store(true)
+	reloaded := make(chan error, 1)
+	go func() {
+		reloaded <- s.mcpManager.LoadMCPs(context.Background())
+	}()
+	<-discovering
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	slow.Store(false)
+	result, err := s.mcpManager.ExecuteTool(ctx, "echo"+ToolNameSeparator+"say", map[string]interface{}{"text": "hello"}, nil)
+	if err != nil {
+		t.Fatalf("ExecuteTool during a reload: %v", err)
+	}
+	if result.IsError || len(result.Content) != 1 || result.Content[0].Text != "hello" {
+		t.Fatalf("result = %+v, want the text hello", result)
+	}
+
+	close(release)
+	if err := <-reloaded; err != nil {
+		t.Fatalf("LoadMCPs: %v", err)
+	}
+	if tools := s.mcpManager.GetAllTools(); len(tools) != 1 {
+		t.Fatalf("tools after reload = %+v, want echo.say", tools)
+	}
+}
+
+func TestClientLogLevel(t *testing.T) {
+	// An MCP that logs at info and error while running a call
+	program := handshakeThen(func(stdin *bufio.Reader, stdout io.Writer) *ProcessExitError {
+		for {
+			line, err := stdin.ReadBytes('\n')
+			var message rpcMessage
+			if json.Unmarshal(line, &message) == nil {
+				if message.Method == "tools/call" {
+					for _, level := range []string{"info", "error"} {
+						fmt.Fprintf(stdout, `{"jsonrpc":"2.0","method":"notifications/message","params":{"level":%q,"data":"logged at %s"}}`+"\n", level, level)
+					}
+				}
+				if reply := echoMCP(message); reply != nil {
+					writeReply(stdout, message, reply)
+				}
+			}
+			if err != nil {
+				return &ProcessExitError{ExitCode: 0}
+			}
+		}
+	})
+	s := newFakeServer(t, program)
+
+	in, input := io.Pipe()
+	output, out := io.Pipe()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.ServeStdioStreams(ctx, in, out)
+	defer input.Close()
+
+	go func() {
+		input.Write([]byte(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-03-26","capabilities":{},"clientInfo":{"name":"test","version":"1.0"}}}` + "\n"))
+		input.Write([]byte(`{"jsonrpc":"2.0","method":"notifications/initialized"}` + "\n"))
+		input.Write([]byte(`{"jsonrpc":"2.0","id":2,"method":"logging/setLevel","params":{"level":"error"}}` + "\n"))
+		input.Write([]byte(`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"echo.say","arguments":{"text":"hello"}}}` + "\n"))
+	}()
+
+	// Read until both the call's result and the error message have arrived;
+	// the info message would have come first
+	var logged []string
+	var answered bool
+	lines := bufio.NewScanner(output)
+	for (!answered || len(logged) == 0) && lines.Scan() {
+		var message struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+			Params struct {
+				Level string `json:"level"`
+			} `json:"params"`
+		}
+		if err := json.Unmarshal(lines.Bytes(), &message); err != nil {
+			t.Fatalf("output %s: %v", lines.Bytes(), err)
+		}
+		switch {
+		case message.Method == "notifications/message":
+			logged = append(logged, message.Params.Level)
+		case string(message.ID) == "3":
+			answered = true
+		}
+	}
+	if len(logged) != 1 || logged[0] != "error" {
+		t.Fatalf("log notifications at %v, want only error", logged)
+	}
+	if level := s.mcpManager.LogLevel(); level != DefaultLogLevel {
+		t.Fatalf("server log level = %s, want it left at %s", level, DefaultLogLevel)
+	}
+}
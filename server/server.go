@@ -1,34 +1,342 @@
 package server
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
-	"os"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/mark3labs/mcp-go/mcp"
 	mcpserver "github.com/mark3labs/mcp-go/server"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+
+	"github.com/mcp-net/mcp-proxy/buildinfo"
 )
 
 // DefaultRequestTimeout is the default timeout for MCP requests
 const DefaultRequestTimeout = 30 * time.Second
 
+// DefaultToolsPageSize is the default number of tools returned per tools/list page
+const DefaultToolsPageSize = 100
+
 // MCPServer is the server that manages MCPs
 type MCPServer struct {
-	mcpManager *MCPManager
-	server     *mcpserver.MCPServer
+	mcpManager    *MCPManager
+	server        *mcpserver.MCPServer
+	name          string
+	version       string
+	toolsPageSize int
+
+	// readyRequiresAllMCPs makes /readyz fail while any MCP is unhealthy
+	readyRequiresAllMCPs bool
+
+	// Limits on the shape of tool call arguments
+	maxArgumentDepth    int
+	maxArgumentElements int
+
+	// maskErrors hides error details from clients, logging them instead
+	maskErrors bool
+
+	// strict rejects requests that don't declare JSON-RPC 2.0
+	strict bool
+
+	// noServerInfo leaves out the server_info and describe_mcp tools
+	noServerInfo bool
+
+	// maxRequestBytes caps the size of HTTP request bodies
+	maxRequestBytes int64
+
+	// maxResultBytes caps the text of tool results sent to clients
+	maxResultBytes int
+
+	// rateLimiter limits the rate of HTTP requests per client, if set
+	rateLimiter *clientLimiter
+
+	// accessLog logs a line for every HTTP request
+	accessLog bool
+
+	// optionErr records an invalid ServerOption
+	optionErr error
+
+	// httpServer, adminServer and grpcServer are the running HTTP, admin and
+	// gRPC servers, if any
+	httpServer  *http.Server
+	adminServer *http.Server
+	grpcServer  *grpc.Server
+	httpMutex   sync.Mutex
+
+	// toolCatalog is the JSON of the MCP tools currently registered with
+	// server, used to tell whether the catalog has changed
+	toolCatalog string
+	toolsMutex  sync.Mutex
+
+	// inflight holds the tool calls in progress by request id, so clients
+	// can cancel them
+	inflight      map[string]*inflightRequest
+	inflightMutex sync.Mutex
+
+	// closed is closed by Close to stop the background checks, and closeErr
+	// is the result of the first Close
+	closed    chan struct{}
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// ServerOption configures optional MCPServer behavior
+type ServerOption func(*MCPServer)
+
+// WithToolsPageSize sets the maximum number of tools returned per tools/list
+// page. A size of zero or less disables pagination.
+func WithToolsPageSize(size int) ServerOption {
+	return func(s *MCPServer) {
+		s.toolsPageSize = size
+	}
+}
+
+// WithReadyRequiresAllMCPs makes the /readyz endpoint report not ready while
+// any loaded MCP has failed, rather than only until loading completes
+func WithReadyRequiresAllMCPs(required bool) ServerOption {
+	return func(s *MCPServer) {
+		s.readyRequiresAllMCPs = required
+	}
+}
+
+// WithArgumentLimits sets the maximum nesting depth and number of elements
+// allowed in tool call arguments. Limits of zero or less are not enforced.
+func WithArgumentLimits(maxDepth, maxElements int) ServerOption {
+	return func(s *MCPServer) {
+		s.maxArgumentDepth = maxDepth
+		s.maxArgumentElements = maxElements
+	}
+}
+
+// WithMaskErrors replaces detailed error messages sent to clients with a
+// generic message and a reference to the full error in the server log
+func WithMaskErrors(mask bool) ServerOption {
+	return func(s *MCPServer) {
+		s.maskErrors = mask
+	}
+}
+
+// WithStrict makes requests whose jsonrpc member isn't "2.0" fail with an
+// Invalid Request error. Otherwise they are processed with a warning.
+func WithStrict(strict bool) ServerOption {
+	return func(s *MCPServer) {
+		s.strict = strict
+	}
+}
+
+// WithServerInfoTool controls whether the stdio and SSE transports serve
+// the server_info and describe_mcp tools alongside the tools of the MCPs.
+// They are served by default.
+func WithServerInfoTool(enabled bool) ServerOption {
+	return func(s *MCPServer) {
+		s.noServerInfo = !enabled
+	}
+}
+
+// WithCircuitBreaker configures the per-MCP circuit breaker: after threshold
+// failures within window, calls to the MCP fail fast for cooldown. A
+// threshold of zero or less disables the breaker.
+func WithCircuitBreaker(threshold int, window, cooldown time.Duration) ServerOption {
+	return func(s *MCPServer) {
+		s.mcpManager.SetCircuitBreaker(threshold, window, cooldown)
+	}
+}
+
+// WithMCPConfigs supplies per-MCP configuration keyed by MCP name, used in
+// place of the manifests next to those MCPs' executables
+func WithMCPConfigs(configs map[string]MCPConfig) ServerOption {
+	return func(s *MCPServer) {
+		s.mcpManager.SetMCPConfigs(configs)
+	}
+}
+
+// WithMaxRequestBytes limits the size of HTTP request bodies; larger
+// requests are rejected with 413. Zero or less disables the limit.
+func WithMaxRequestBytes(n int64) ServerOption {
+	return func(s *MCPServer) {
+		s.maxRequestBytes = n
+	}
+}
+
+// WithMaxResultBytes truncates the text of tool results to at most n bytes,
+// marking where text was cut. Zero or less disables truncation.
+func WithMaxResultBytes(n int) ServerOption {
+	return func(s *MCPServer) {
+		s.maxResultBytes = n
+	}
+}
+
+// WithRateLimit limits each client IP to requestsPerSecond HTTP requests on
+// average, in bursts of up to burst; requests over the limit are rejected
+// with 429. A rate of zero or less disables the limit.
+func WithRateLimit(requestsPerSecond float64, burst int) ServerOption {
+	return func(s *MCPServer) {
+		if requestsPerSecond > 0 {
+			s.rateLimiter = newClientLimiter(requestsPerSecond, burst)
+		}
+	}
+}
+
+// WithAccessLog logs the client, JSON-RPC method, tool, status and duration
+// of every HTTP request
+func WithAccessLog(enabled bool) ServerOption {
+	return func(s *MCPServer) {
+		s.accessLog = enabled
+	}
+}
+
+// WithPayloadLogging logs the arguments and results of tool calls, with the
+// values of redactKeys masked
+func WithPayloadLogging(enabled bool, redactKeys []string) ServerOption {
+	return func(s *MCPServer) {
+		s.mcpManager.SetPayloadLogging(enabled, redactKeys)
+	}
+}
+
+// WithFailIfEmpty makes loading fail if the MCP directory holds no MCPs,
+// catching a misconfigured directory early
+func WithFailIfEmpty(enabled bool) ServerOption {
+	return func(s *MCPServer) {
+		s.mcpManager.SetFailIfEmpty(enabled)
+	}
+}
+
+// WithManifestList loads the MCPs listed in the manifest list at path
+// instead of scanning the MCP directory, if path isn't empty
+func WithManifestList(path string) ServerOption {
+	return func(s *MCPServer) {
+		s.mcpManager.SetManifestList(path)
+	}
+}
+
+// WithMCPDirectories scans dirs for MCPs, in order, in place of the
+// directory the server was created with
+func WithMCPDirectories(dirs []string) ServerOption {
+	return func(s *MCPServer) {
+		s.mcpManager.SetMCPDirectories(dirs)
+	}
+}
+
+// WithDirectoryConflicts sets how an MCP name found under more than one MCP
+// directory is resolved, DirConflictOverride or DirConflictError
+func WithDirectoryConflicts(mode string) ServerOption {
+	return func(s *MCPServer) {
+		if err := s.mcpManager.SetDirectoryConflicts(mode); err != nil {
+			s.optionErr = err
+		}
+	}
+}
+
+// WithLaunchers registers the commands that run script MCPs by file
+// extension, on top of the defaults
+func WithLaunchers(launchers map[string][]string) ServerOption {
+	return func(s *MCPServer) {
+		s.mcpManager.SetLaunchers(launchers)
+	}
+}
+
+// WithTimeouts sets how long discovering an MCP's tools may take and the
+// default limit of tool calls, with zero for no limit
+func WithTimeouts(discovery, exec time.Duration) ServerOption {
+	return func(s *MCPServer) {
+		s.mcpManager.SetTimeouts(discovery, exec)
+	}
+}
+
+// WithProtocolVersion sets the protocol version requested from MCPs
+func WithProtocolVersion(version string) ServerOption {
+	return func(s *MCPServer) {
+		s.mcpManager.SetProtocolVersion(version)
+	}
+}
+
+// WithPassthrough serves the tools of the only MCP in the directory under
+// their own names, failing to load if there is more than one MCP
+func WithPassthrough(enabled bool) ServerOption {
+	return func(s *MCPServer) {
+		s.mcpManager.SetPassthrough(enabled)
+	}
+}
+
+// WithResultCacheSize bounds the number of results cached for tools marked
+// cacheable, with zero disabling the cache
+func WithResultCacheSize(size int) ServerOption {
+	return func(s *MCPServer) {
+		s.mcpManager.SetResultCacheSize(size)
+	}
+}
+
+// WithCoalescing makes concurrent calls of the same tool with identical
+// arguments share a single execution and its result
+func WithCoalescing(enabled bool) ServerOption {
+	return func(s *MCPServer) {
+		s.mcpManager.SetCoalescing(enabled)
+	}
+}
+
+// WithToolCache caches discovered tools in the file at path, so MCPs whose
+// file and configuration are unchanged skip discovery on the next start
+func WithToolCache(path string) ServerOption {
+	return func(s *MCPServer) {
+		s.mcpManager.SetToolCache(path)
+	}
+}
+
+// WithArgTransformer reshapes the arguments of calls to the tools of the MCP
+// named mcpName with transformer before they are sent to it
+func WithArgTransformer(mcpName string, transformer ArgTransformer) ServerOption {
+	return func(s *MCPServer) {
+		s.mcpManager.SetArgTransformer(mcpName, transformer)
+	}
+}
+
+// WithCommandRunner starts MCP subprocesses with runner instead of running
+// them as operating system processes
+func WithCommandRunner(runner CommandRunner) ServerOption {
+	return func(s *MCPServer) {
+		s.mcpManager.SetCommandRunner(runner)
+	}
+}
+
+// WithAliases exposes tools under alternative names, mapping each alias to
+// the namespaced tool it stands for
+func WithAliases(aliases map[string]string) ServerOption {
+	return func(s *MCPServer) {
+		if err := s.mcpManager.SetAliases(aliases); err != nil {
+			s.optionErr = err
+		}
+	}
+}
+
+// WithToolFilter limits the tools served to those matching the allow glob
+// patterns, if any, and not matching the deny patterns. Patterns match the
+// namespaced tool name, e.g. "calculator-mcp.*".
+func WithToolFilter(allow, deny []string) ServerOption {
+	return func(s *MCPServer) {
+		if err := s.mcpManager.SetToolFilter(allow, deny); err != nil {
+			s.optionErr = err
+		}
+	}
 }
 
 // NewMCPServer creates a new MCP server
-func NewMCPServer(mcpDirectory string, name, version string) (*MCPServer, error) {
+func NewMCPServer(mcpDirectory string, name, version string, opts ...ServerOption) (*MCPServer, error) {
 	// Create the MCP manager
 	mcpManager := NewMCPManager(mcpDirectory)
-	if err := mcpManager.LoadMCPs(); err != nil {
-		return nil, fmt.Errorf("failed to load MCPs: %w", err)
-	}
 
 	// Create the MCP server
 	server := mcpserver.NewMCPServer(name, version,
@@ -38,142 +346,666 @@ func NewMCPServer(mcpDirectory string, name, version string) (*MCPServer, error)
 
 	// Create the server
 	mcpServer := &MCPServer{
-		mcpManager: mcpManager,
-		server:     server,
+		mcpManager:    mcpManager,
+		server:        server,
+		name:          name,
+		version:       version,
+		toolsPageSize: DefaultToolsPageSize,
+
+		maxArgumentDepth:    DefaultMaxArgumentDepth,
+		maxArgumentElements: DefaultMaxArgumentElements,
+		maxRequestBytes:     DefaultMaxRequestBytes,
+
+		closed: make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(mcpServer)
+	}
+	if mcpServer.optionErr != nil {
+		return nil, mcpServer.optionErr
+	}
+
+	// Load the MCPs once the options have configured the manager
+	if err := mcpManager.LoadMCPs(context.Background()); err != nil {
+		return nil, fmt.Errorf("failed to load MCPs: %w", err)
 	}
 
-	// Register our custom tools
-	mcpServer.registerToolsHandler()
+	// Expose our custom tools and the loaded MCP tools to the stdio and SSE
+	// transports
+	mcpServer.registerMCPTools()
 
 	return mcpServer, nil
 }
 
-// registerToolsHandler registers custom tools for the server
-func (s *MCPServer) registerToolsHandler() {
-	// Add a dummy tool to tell clients we're running in server mode
-	dummyTool := mcp.NewTool("server_info",
-		mcp.WithDescription("Get information about the MCP server"),
+// serverInfoTool returns the custom tool that describes the server and the
+// MCPs it has loaded
+func (s *MCPServer) serverInfoTool() mcpserver.ServerTool {
+	tool := mcp.NewTool("server_info",
+		mcp.WithDescription("Get information about the MCP server and its loaded MCPs"),
 	)
 
-	s.server.AddTool(dummyTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		return mcp.NewToolResultText("Running in MCP server mode"), nil
-	})
+	return mcpserver.ServerTool{Tool: tool, Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		info := map[string]interface{}{
+			"name":       s.name,
+			"version":    s.version,
+			"build":      buildinfo.Get(),
+			"mcps":       s.mcpManager.GetMCPSummaries(),
+			"loadErrors": s.mcpManager.LoadErrors(),
+		}
+		data, err := json.Marshal(info)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal server info: %w", err)
+		}
+		return mcp.NewToolResultText(string(data)), nil
+	}}
+}
+
+// describeMCPTool returns the custom tool that describes one MCP in full:
+// its capabilities, tool schemas, resources and prompts
+func (s *MCPServer) describeMCPTool() mcpserver.ServerTool {
+	tool := mcp.NewTool("describe_mcp",
+		mcp.WithDescription("Get the capabilities, tool schemas, resources and prompts advertised by one loaded MCP"),
+		mcp.WithString("name",
+			mcp.Required(),
+			mcp.Description("Name of the MCP, as listed by server_info"),
+		),
+	)
+
+	return mcpserver.ServerTool{Tool: tool, Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		name, _ := request.Params.Arguments["name"].(string)
+		description, err := s.mcpManager.DescribeMCP(name)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		data, err := json.Marshal(description)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal MCP description: %w", err)
+		}
+		return mcp.NewToolResultText(string(data)), nil
+	}}
+}
+
+// registerMCPTools registers every tool from the enabled MCPs with the
+// underlying mcp-go server, forwarding calls to the MCP manager, alongside
+// the custom tools. When the catalog differs from the one registered by a
+// previous call, it is replaced and connected stdio and SSE clients are
+// sent a notifications/tools/list_changed notification.
+func (s *MCPServer) registerMCPTools() {
+	s.toolsMutex.Lock()
+	defer s.toolsMutex.Unlock()
+
+	tools := s.mcpManager.GetAllTools()
+	catalog, err := json.Marshal(tools)
+	if err != nil {
+		s.logf("warning", "Warning: Failed to marshal tool catalog: %v\n", err)
+	} else if s.toolCatalog != "" && string(catalog) == s.toolCatalog {
+		return
+	}
+	s.toolCatalog = string(catalog)
+
+	var serverTools []mcpserver.ServerTool
+	if !s.noServerInfo {
+		serverTools = append(serverTools, s.serverInfoTool(), s.describeMCPTool())
+	}
+	for _, tool := range tools {
+		toolName := tool.Name
+
+		mcpTool := mcp.Tool{
+			Name:        tool.Name,
+			Description: tool.Description,
+		}
+		if tool.Parameters != nil {
+			schema, err := json.Marshal(tool.Parameters)
+			if err != nil {
+				s.logf("warning", "Warning: Failed to marshal input schema for %s: %v\n", toolName, err)
+				continue
+			}
+			mcpTool.RawInputSchema = schema
+		} else {
+			mcpTool.InputSchema = mcp.ToolInputSchema{
+				Type:       "object",
+				Properties: map[string]interface{}{},
+			}
+		}
+
+		serverTools = append(serverTools, mcpserver.ServerTool{
+			Tool: mcpTool,
+			Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+				// Relay progress and log notifications to the client session
+				// over its own transport
+				if request.Params.Meta != nil {
+					ctx = withProgressToken(ctx, request.Params.Meta.ProgressToken)
+				}
+				progressFn := notificationRelay(ctx, func(notification []byte) {
+					var message struct {
+						Method string                 `json:"method"`
+						Params map[string]interface{} `json:"params"`
+					}
+					if err := json.Unmarshal(notification, &message); err != nil {
+						return
+					}
+					s.server.SendNotificationToClient(ctx, message.Method, message.Params)
+				})
+
+				result, err := s.mcpManager.ExecuteTool(ctx, toolName, request.Params.Arguments, progressFn)
+				if err != nil {
+					return nil, s.maskedError("failed to execute tool", err)
+				}
+				result = truncateResult(result, s.maxResultBytes)
+
+				raw, err := json.Marshal(result)
+				if err != nil {
+					return nil, fmt.Errorf("failed to marshal tool result: %w", err)
+				}
+				rawMessage := json.RawMessage(raw)
+				return mcp.ParseCallToolResult(&rawMessage)
+			},
+		})
+	}
+
+	// Replacing the tools notifies every initialized client session
+	s.server.SetTools(serverTools...)
+}
+
+// SetGroupEnabled enables or disables serving the tools of an MCP group
+func (s *MCPServer) SetGroupEnabled(group string, enabled bool) {
+	s.mcpManager.SetGroupEnabled(group, enabled)
+	s.registerMCPTools()
+}
+
+// SetMCPEnabled enables or disables serving the tools of a single MCP
+func (s *MCPServer) SetMCPEnabled(name string, enabled bool) error {
+	if err := s.mcpManager.SetMCPEnabled(name, enabled); err != nil {
+		return err
+	}
+	s.registerMCPTools()
+	return nil
+}
+
+// Reload rescans the MCP directory and rediscovers every MCP's tools
+func (s *MCPServer) Reload(ctx context.Context) error {
+	if err := s.mcpManager.LoadMCPs(ctx); err != nil {
+		return err
+	}
+	s.registerMCPTools()
+	return nil
+}
+
+// ReloadGroup rediscovers the tools of every MCP in a group
+func (s *MCPServer) ReloadGroup(ctx context.Context, group string) error {
+	if err := s.mcpManager.ReloadGroup(ctx, group); err != nil {
+		return err
+	}
+	s.registerMCPTools()
+	return nil
+}
+
+// newServeMux creates a mux with the health and metrics endpoints shared by
+// all HTTP transports
+func (s *MCPServer) newServeMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/livez", s.handleLivez)
+	mux.HandleFunc("/readyz", s.handleReadyz)
+	mux.HandleFunc("/metrics", s.handleMetrics)
+	return mux
+}
+
+// rateLimited applies the rate limit, if any, to handler. The health
+// endpoints are deliberately left unlimited.
+func (s *MCPServer) rateLimited(handler http.Handler) http.Handler {
+	if s.rateLimiter == nil {
+		return handler
+	}
+	return s.rateLimiter.wrap(handler)
 }
 
 // ServeHTTP serves the MCP over HTTP
 func (s *MCPServer) ServeHTTP(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.ServeHTTPListener(ln)
+}
+
+// ServeHTTPListener serves the MCP over HTTP on an existing listener, such
+// as one inherited from a parent process during a graceful restart
+func (s *MCPServer) ServeHTTPListener(ln net.Listener) error {
+	mux := s.newServeMux()
+	mux.Handle("/", s.accessLogged(s.rateLimited(http.HandlerFunc(s.handleRPC))))
+
+	// Start the server
+	s.logf("info", "MCP Server listening on %s\n", ln.Addr())
+	return s.serve(ln, mux)
+}
+
+// ServeSSE serves the MCP over HTTP using the Server-Sent Events transport.
+// Clients open an event stream with GET /sse and post messages to the
+// endpoint announced on that stream.
+func (s *MCPServer) ServeSSE(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.ServeSSEListener(ln)
+}
+
+// ServeSSEListener serves the MCP over the SSE transport on an existing listener
+func (s *MCPServer) ServeSSEListener(ln net.Listener) error {
+	sseServer := mcpserver.NewSSEServer(s.server,
+		mcpserver.WithUseFullURLForMessageEndpoint(false),
+	)
+
+	mux := s.newServeMux()
+	mux.Handle(sseServer.CompleteSsePath(), s.rateLimited(sseServer))
+	mux.Handle(sseServer.CompleteMessagePath(), s.rateLimited(sseServer))
+
+	// Start the server
+	s.logf("info", "MCP SSE Server listening on %s\n", ln.Addr())
+	return s.serve(ln, mux)
+}
+
+// serve runs an HTTP server for handler on ln until it fails or is shut down
+func (s *MCPServer) serve(ln net.Listener, handler http.Handler) error {
 	server := &http.Server{
-		Addr: addr,
-		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if r.Method != http.MethodPost {
-				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-				return
-			}
+		Handler: handler,
+	}
 
-			// Read the request body
-			body, err := io.ReadAll(r.Body)
-			if err != nil {
-				http.Error(w, "Failed to read request body", http.StatusBadRequest)
-				return
-			}
+	s.httpMutex.Lock()
+	s.httpServer = server
+	s.httpMutex.Unlock()
 
-			// Process the request
-			response, err := s.ProcessRequest(r.Context(), body)
-			if err != nil {
-				http.Error(w, fmt.Sprintf("Failed to process request: %v", err), http.StatusInternalServerError)
-				return
+	return server.Serve(ln)
+}
+
+// Shutdown stops accepting HTTP, admin and gRPC connections and waits for
+// in-flight requests to finish or ctx to expire. Persistent MCP subprocesses are then
+// shut down once their calls finish.
+func (s *MCPServer) Shutdown(ctx context.Context) error {
+	defer s.mcpManager.stopProcesses()
+
+	s.httpMutex.Lock()
+	servers := []*http.Server{s.httpServer, s.adminServer}
+	s.httpMutex.Unlock()
+
+	var errs []error
+	for _, server := range servers {
+		if server != nil {
+			if err := server.Shutdown(ctx); err != nil {
+				errs = append(errs, err)
 			}
+		}
+	}
+	if err := s.stopGRPC(ctx); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
 
-			// Write the response
-			w.Header().Set("Content-Type", "application/json")
-			w.Write(response)
-		}),
+// handleRPC handles JSON-RPC requests posted to the server
+func (s *MCPServer) handleRPC(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
 	}
 
-	// Start the server
-	fmt.Fprintf(os.Stderr, "MCP Server listening on %s\n", addr)
-	return server.ListenAndServe()
+	// Read the request body, decompressing it first so the limit applies to
+	// what is actually processed, and refusing bodies over the limit
+	if err := decodeRequestBody(r); err != nil {
+		if errors.Is(err, errUnsupportedEncoding) {
+			http.Error(w, "Unsupported content encoding", http.StatusUnsupportedMediaType)
+			return
+		}
+		http.Error(w, "Failed to decompress request body", http.StatusBadRequest)
+		return
+	}
+	if s.maxRequestBytes > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, s.maxRequestBytes)
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+
+	// Clients that accept an event stream get notifications as they happen
+	var stream *eventStream
+	var notify NotifyFunc
+	if acceptsEventStream(r) {
+		stream = newEventStream(w)
+		if stream != nil {
+			notify = stream.send
+		}
+	}
+
+	// A body that isn't JSON at all is a transport-level failure
+	if !json.Valid(body) {
+		response, _ := newErrorResponse(nil, -32700, "Parse error")
+		writeJSON(w, r, http.StatusBadRequest, response)
+		return
+	}
+	if entry := accessEntryFrom(r.Context()); entry != nil {
+		entry.describe(body)
+	}
+
+	// Process the request. Application-level failures are reported to the
+	// client as a JSON-RPC error with a 200 status.
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	response, err := s.ProcessRequestStream(ctx, body, notify)
+	if err != nil {
+		response = s.processingErrorResponse(body, err)
+	}
+
+	// Once streaming has started the final response must go on the stream too
+	if stream != nil && stream.isStarted() {
+		if response != nil {
+			stream.send(response)
+		}
+		return
+	}
+
+	// Notifications get no response body
+	if response == nil {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	// Write the response
+	writeJSON(w, r, http.StatusOK, response)
 }
 
-// ServeStdio serves the MCP over standard input/output
-func (s *MCPServer) ServeStdio() error {
-	// Start the stdio server
-	return mcpserver.ServeStdio(s.server)
+// handleLivez reports that the process is up. It deliberately avoids the
+// MCP manager and subprocesses so a slow MCP can't fail the liveness probe.
+func (s *MCPServer) handleLivez(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte("ok\n"))
+}
+
+// handleReadyz reports whether the server is ready to serve tool calls: the
+// MCPs must be loaded and, if configured, none of them may have failed or
+// be unhealthy.
+func (s *MCPServer) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if !s.mcpManager.Loaded() {
+		http.Error(w, "MCPs not loaded", http.StatusServiceUnavailable)
+		return
+	}
+
+	if s.readyRequiresAllMCPs {
+		for _, summary := range s.mcpManager.GetMCPSummaries() {
+			if summary.Status != MCPStatusLoaded || summary.Health != MCPHealthHealthy {
+				http.Error(w, fmt.Sprintf("MCP not ready: %s", summary.Name), http.StatusServiceUnavailable)
+				return
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte("ok\n"))
 }
 
-// ProcessRequest processes a raw MCP request
+// ProcessRequest processes a raw MCP request. The response is nil for
+// notifications, which get no reply.
 func (s *MCPServer) ProcessRequest(ctx context.Context, rawRequest []byte) ([]byte, error) {
+	return s.ProcessRequestStream(ctx, rawRequest, nil)
+}
+
+// ProcessRequestStream processes a raw MCP request, passing any messages
+// produced before the final response to notify. A nil notify discards them.
+// The response is nil for notifications.
+func (s *MCPServer) ProcessRequestStream(ctx context.Context, rawRequest []byte, notify NotifyFunc) ([]byte, error) {
+	// Process the elements of a batch individually
+	if isBatch(rawRequest) {
+		return processBatch(rawRequest, func(element json.RawMessage) []byte {
+			return s.processBatchElement(element, func(request []byte) ([]byte, error) {
+				return s.ProcessRequestStream(ctx, request, notify)
+			})
+		})
+	}
+
 	// Parse the request
 	var request struct {
-		JSONRPC string      `json:"jsonrpc"`
-		ID      interface{} `json:"id"`
-		Method  string      `json:"method"`
+		JSONRPC string          `json:"jsonrpc"`
+		ID      json.RawMessage `json:"id"`
+		Method  string          `json:"method"`
 	}
 	if err := json.Unmarshal(rawRequest, &request); err != nil {
 		return nil, fmt.Errorf("failed to parse request: %w", err)
 	}
 
+	if request.JSONRPC != "2.0" {
+		if s.strict {
+			return newErrorResponse(request.ID, -32600, fmt.Sprintf("Invalid Request: unsupported JSON-RPC version %q", request.JSONRPC))
+		}
+		s.logf("warning", "Warning: Request declares JSON-RPC version %q instead of \"2.0\"\n", request.JSONRPC)
+	}
+
+	ctx, span := tracer.Start(ctx, request.Method, trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(attribute.String("rpc.system", "jsonrpc"), attribute.String("rpc.method", request.Method)))
+	response, err := s.processRequest(ctx, request.ID, request.Method, rawRequest, notify)
+	endSpan(span, err)
+	return response, err
+}
+
+// processRequest dispatches a single parsed request to its handler
+func (s *MCPServer) processRequest(ctx context.Context, id json.RawMessage, method string, rawRequest []byte, notify NotifyFunc) ([]byte, error) {
+	// A request without an id (or with a null id) is a notification, which
+	// must not be answered
+	if isNotification(id) {
+		s.handleNotification(ctx, method, rawRequest)
+		return nil, nil
+	}
+
+	// Answer keepalives without involving any MCP
+	if method == "ping" {
+		return newResultResponse(id, map[string]interface{}{})
+	}
+
+	if method == "logging/setLevel" {
+		return s.handleSetLevel(ctx, id, rawRequest)
+	}
+
 	// Handle tools/list specially
-	if request.Method == "tools/list" {
-		return s.handleToolsList(ctx, request.ID)
+	if method == "tools/list" {
+		return s.handleToolsList(ctx, id, rawRequest)
 	}
 
-	// Handle tools/call specially
-	if request.Method == "tools/call" {
-		return s.handleToolsCall(ctx, request.ID, rawRequest)
+	// Handle tools/call specially, letting the client cancel it
+	if method == "tools/call" {
+		ctx, done := s.trackRequest(ctx, id)
+		defer done()
+		return s.handleToolsCall(ctx, id, rawRequest, notify)
 	}
 
-	// For other methods, let the server handle it
-	// In a real implementation, you would create a function to handle the request directly
-	// For now, we'll just return an error since we're not handling these methods yet
-	return nil, fmt.Errorf("method not implemented: %s", request.Method)
+	// Any other method is unknown to the server
+	return newErrorResponse(id, -32601, fmt.Sprintf("Method not found: %s", method))
+}
+
+// handleNotification processes a notification. A tools/call sent as a
+// notification still runs the tool, but its outcome is only logged.
+func (s *MCPServer) handleNotification(ctx context.Context, method string, rawRequest []byte) {
+	if method == "notifications/cancelled" {
+		s.handleCancelled(rawRequest)
+		return
+	}
+	if method != "tools/call" {
+		return
+	}
+
+	response, err := s.handleToolsCall(ctx, nil, rawRequest, nil)
+	if err != nil {
+		s.logf("warning", "Warning: Failed to process tools/call notification: %v\n", err)
+		return
+	}
+
+	var result struct {
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(response, &result) == nil && result.Error != nil {
+		s.logf("warning", "Warning: tools/call notification failed: %s\n", result.Error.Message)
+	}
+}
+
+// handleSetLevel handles the logging/setLevel method, setting the least
+// severe level of the log notifications relayed to the client's session.
+// Clients without a session, such as those over HTTP, are only answered.
+// The server's own log level is left alone.
+func (s *MCPServer) handleSetLevel(ctx context.Context, id json.RawMessage, rawRequest []byte) ([]byte, error) {
+	var request struct {
+		Params struct {
+			Level string `json:"level"`
+		} `json:"params"`
+	}
+	if err := json.Unmarshal(rawRequest, &request); err != nil {
+		return nil, fmt.Errorf("failed to parse logging/setLevel params: %w", err)
+	}
+
+	severity, ok := logLevelSeverity(request.Params.Level)
+	if !ok {
+		return newErrorResponse(id, -32602, fmt.Sprintf("Invalid params: invalid log level: %s", request.Params.Level))
+	}
+	if level := clientLogLevelFrom(ctx); level != nil {
+		level.severity.Store(int32(severity) + 1)
+	}
+	return newResultResponse(id, map[string]interface{}{})
 }
 
 // handleToolsList handles the tools/list method
-func (s *MCPServer) handleToolsList(ctx context.Context, id interface{}) ([]byte, error) {
-	// Get all tools from all MCPs
-	tools := s.mcpManager.GetAllTools()
+func (s *MCPServer) handleToolsList(ctx context.Context, id json.RawMessage, rawRequest []byte) ([]byte, error) {
+	// Parse the request parameters
+	var request struct {
+		Params struct {
+			Cursor string `json:"cursor"`
+			// Group is an extension that limits the list to one MCP group
+			Group string `json:"group"`
+		} `json:"params"`
+	}
+	if err := json.Unmarshal(rawRequest, &request); err != nil {
+		return nil, fmt.Errorf("failed to parse request: %w", err)
+	}
+
+	// Get all tools from all MCPs, or just the requested group, sorted by name
+	var tools []ToolInfo
+	if request.Params.Group != "" {
+		tools = s.mcpManager.GetGroupTools(request.Params.Group)
+	} else {
+		tools = s.mcpManager.GetAllTools()
+	}
+
+	// Skip past the tools returned on previous pages
+	if request.Params.Cursor != "" {
+		after, err := decodeToolsCursor(request.Params.Cursor)
+		if err != nil {
+			return newErrorResponse(id, -32602, fmt.Sprintf("Invalid cursor: %v", err))
+		}
+		start := sort.Search(len(tools), func(i int) bool {
+			return tools[i].Name > after
+		})
+		tools = tools[start:]
+	}
+
+	result := map[string]interface{}{}
+
+	// Trim to a single page and point the client at the next one
+	if s.toolsPageSize > 0 && len(tools) > s.toolsPageSize {
+		tools = tools[:s.toolsPageSize]
+		result["nextCursor"] = encodeToolsCursor(tools[len(tools)-1].Name)
+	}
+
+	// Every listed tool needs an input schema
+	listed := make([]ToolInfo, len(tools))
+	for i, tool := range tools {
+		if tool.Parameters == nil {
+			tool.Parameters = defaultInputSchema()
+		}
+		listed[i] = tool
+	}
+	result["tools"] = listed
 
 	// Create the response
 	response := map[string]interface{}{
 		"jsonrpc": "2.0",
 		"id":      id,
-		"result": map[string]interface{}{
-			"tools": tools,
-		},
+		"result":  result,
 	}
 
 	// Serialize the response
-	return json.Marshal(response)
+	return marshalResponse(response)
+}
+
+// encodeToolsCursor builds an opaque tools/list cursor that resumes after the
+// named tool. Keying on the name rather than an offset keeps cursors valid
+// when tools are added or removed between calls.
+func encodeToolsCursor(lastToolName string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(lastToolName))
+}
+
+// decodeToolsCursor returns the tool name encoded in a tools/list cursor
+func decodeToolsCursor(cursor string) (string, error) {
+	name, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", err
+	}
+	return string(name), nil
 }
 
 // handleToolsCall handles the tools/call method
-func (s *MCPServer) handleToolsCall(ctx context.Context, id interface{}, rawRequest []byte) ([]byte, error) {
-	// Parse the request parameters
+func (s *MCPServer) handleToolsCall(ctx context.Context, id json.RawMessage, rawRequest []byte, notify NotifyFunc) ([]byte, error) {
+	// Parse the request parameters, leaving the arguments raw until their
+	// complexity has been checked
 	var request struct {
 		Params struct {
-			Name      string                 `json:"name"`
-			Arguments map[string]interface{} `json:"arguments"`
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+			Meta      struct {
+				ProgressToken interface{} `json:"progressToken"`
+			} `json:"_meta"`
 		} `json:"params"`
 	}
 	if err := json.Unmarshal(rawRequest, &request); err != nil {
-		return nil, fmt.Errorf("failed to parse request: %w", err)
+		// The request was already parsed as JSON, so its params are of the
+		// wrong shape, which is the client's mistake
+		return newErrorResponse(id, CodeInvalidParams, "Invalid params: expected an object naming the tool to call")
+	}
+
+	// Reject pathological arguments before they reach the MCP
+	if err := checkJSONComplexity(request.Params.Arguments, s.maxArgumentDepth, s.maxArgumentElements); err != nil {
+		return newErrorResponse(id, CodeInvalidParams, fmt.Sprintf("Invalid arguments: %v", err))
+	}
+
+	var arguments map[string]interface{}
+	if len(request.Params.Arguments) > 0 {
+		if err := json.Unmarshal(request.Params.Arguments, &arguments); err != nil {
+			return newErrorResponse(id, CodeInvalidParams, "Invalid arguments: expected an object")
+		}
+	}
+
+	s.mcpManager.logPayload("Request %s to call %s: %s\n", arguments, id, request.Params.Name)
+
+	// Relay progress and log notifications when the transport can stream
+	// them
+	var progressFn ProgressFunc
+	if notify != nil {
+		ctx = withProgressToken(ctx, request.Params.Meta.ProgressToken)
+		progressFn = notificationRelay(ctx, notify)
 	}
 
 	// Execute the tool
-	result, err := s.mcpManager.ExecuteTool(ctx, request.Params.Name, request.Params.Arguments)
+	result, err := s.mcpManager.ExecuteTool(ctx, request.Params.Name, arguments, progressFn)
 	if err != nil {
-		// Create an error response
-		errorResponse := map[string]interface{}{
-			"jsonrpc": "2.0",
-			"id":      id,
-			"error": map[string]interface{}{
-				"code":    -32000,
-				"message": fmt.Sprintf("Failed to execute tool: %v", err),
-			},
+		// Filtered tools look as if they don't exist
+		if errors.Is(err, ErrToolDenied) {
+			return newErrorResponse(id, CodeToolNotFound, fmt.Sprintf("Tool not found: %s", request.Params.Name))
 		}
-		return json.Marshal(errorResponse)
+		return newErrorResponse(id, toolCallErrorCode(err), s.clientError("Failed to execute tool", err))
 	}
+	result = truncateResult(result, s.maxResultBytes)
 
 	// Create the success response
 	response := map[string]interface{}{
@@ -181,7 +1013,69 @@ func (s *MCPServer) handleToolsCall(ctx context.Context, id interface{}, rawRequ
 		"id":      id,
 		"result":  result,
 	}
+	s.mcpManager.logPayload("Response to request %s: %s\n", response, id)
 
 	// Serialize the response
-	return json.Marshal(response)
+	return marshalResponse(response)
+}
+
+// processingErrorResponse returns the JSON-RPC error response reporting
+// that rawRequest failed with err, or nil if the request was a notification
+func (s *MCPServer) processingErrorResponse(rawRequest []byte, err error) []byte {
+	var request struct {
+		ID json.RawMessage `json:"id"`
+	}
+	if json.Unmarshal(rawRequest, &request) != nil {
+		response, _ := newErrorResponse(nil, -32600, "Invalid Request")
+		return response
+	}
+	if isNotification(request.ID) {
+		s.logf("warning", "Warning: Failed to process notification: %v\n", err)
+		return nil
+	}
+
+	response, _ := newErrorResponse(request.ID, -32603, s.clientError("Failed to process request", err))
+	return response
+}
+
+// isNotification reports whether id, the raw id member of a request, makes
+// it a notification: missing or null
+func isNotification(id json.RawMessage) bool {
+	return len(id) == 0 || string(id) == "null"
+}
+
+// marshalResponse serializes a JSON-RPC response. HTML escaping is turned
+// off so the id is echoed byte for byte as the client sent it.
+func marshalResponse(response interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(response); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// newResultResponse serializes a successful JSON-RPC response. The id is
+// the raw id of the request, so it is echoed exactly, large integers and
+// all, and nil for none.
+func newResultResponse(id json.RawMessage, result interface{}) ([]byte, error) {
+	return marshalResponse(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"result":  result,
+	})
+}
+
+// newErrorResponse serializes a JSON-RPC error response
+func newErrorResponse(id json.RawMessage, code int, message string) ([]byte, error) {
+	errorResponse := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"error": map[string]interface{}{
+			"code":    code,
+			"message": message,
+		},
+	}
+	return marshalResponse(errorResponse)
 }
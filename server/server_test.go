@@ -0,0 +1,48 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestToolsCallInvalidParams(t *testing.T) {
+	s := newFakeServer(t, serveRPC(echoMCP))
+
+	tests := []struct {
+		name   string
+		params string
+	}{
+		{name: "array", params: `["echo.say"]`},
+		{name: "string", params: `"echo.say"`},
+		{name: "number name", params: `{"name":7}`},
+		{name: "number arguments", params: `{"name":"echo.say","arguments":7}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":` + tt.params + `}`
+			response, err := s.ProcessRequest(context.Background(), []byte(request))
+			if err != nil {
+				t.Fatalf("ProcessRequest(%s): %v", request, err)
+			}
+
+			var message struct {
+				Error *struct {
+					Code    int    `json:"code"`
+					Message string `json:"message"`
+				} `json:"error"`
+			}
+			if err := json.Unmarshal(response, &message); err != nil {
+				t.Fatalf("response %s: %v", response, err)
+			}
+			if message.Error == nil || message.Error.Code != CodeInvalidParams {
+				t.Fatalf("response = %s, want error code %d", response, CodeInvalidParams)
+			}
+			if strings.Contains(message.Error.Message, "json:") {
+				t.Errorf("error message = %q, want no decoder details", message.Error.Message)
+			}
+		})
+	}
+}
@@ -0,0 +1,480 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// errSubprocessExited is returned when an MCP closes its stdin, usually by
+// exiting, before a request has been completely written to it
+var errSubprocessExited = fmt.Errorf("%w before reading the request", ErrMCPExited)
+
+// mcpSession is an MCP that has completed the initialize handshake and
+// exchanges newline-delimited JSON-RPC, either over the stdio of a
+// subprocess or over a network connection
+type mcpSession struct {
+	// process is the subprocess, or nil for a network MCP, whose connection
+	// is both stdin and stdout
+	process MCPProcess
+	stdin   io.WriteCloser
+	stdout  io.ReadCloser
+	reader  *bufio.Reader
+
+	// endpoint is the address of a network MCP
+	endpoint string
+
+	// nextID is the id of the next request sent to the MCP
+	nextID int
+
+	// contentLength is set if messages written to the MCP are framed by
+	// Content-Length headers rather than newlines
+	contentLength bool
+
+	// maxMessageBytes caps the size of messages read from the MCP
+	maxMessageBytes int
+
+	// relay merges JSON-RPC messages from stderr into those read from
+	// stdout, if the MCP is configured to answer there
+	relay *stderrRelay
+
+	// exited is closed once the subprocess has exited, after exitErr is set
+	// to describe how it ended, or once the connection is closed
+	exited    chan struct{}
+	exitErr   *ProcessExitError
+	closeOnce sync.Once
+
+	// supportsLogging is set if the MCP advertised the logging capability
+	supportsLogging bool
+
+	// protocolVersion is the protocol version the MCP agreed to, if it said
+	protocolVersion string
+
+	// capabilities is the capabilities object of the initialize result
+	capabilities json.RawMessage
+
+	// serverName, serverVersion and instructions are what the MCP said
+	// about itself in the initialize result, if anything
+	serverName    string
+	serverVersion string
+	instructions  string
+}
+
+// startSession starts the MCP at mcpPath with runner, or connects to it if
+// it has an endpoint, and initializes it, requesting protocolVersion. The
+// session outlives ctx, which only bounds the handshake; the caller must
+// kill or shut down the session once finished with it.
+func startSession(ctx context.Context, runner CommandRunner, protocolVersion, mcpPath string, config MCPConfig) (*mcpSession, error) {
+	if !validFraming(config.Framing) {
+		return nil, fmt.Errorf("invalid framing %q, expected %q or %q", config.Framing, FramingNewline, FramingContentLength)
+	}
+	if config.Endpoint != "" {
+		return dialSession(ctx, protocolVersion, config)
+	}
+
+	process, err := runner.Start(mcpPath, config)
+	if err != nil {
+		return nil, &StartError{Path: mcpPath, Err: err}
+	}
+
+	session := &mcpSession{
+		process: process,
+		stdin:   process.Stdin(),
+		stdout:  process.Stdout(),
+		reader:  bufio.NewReader(process.Stdout()),
+		nextID:  1,
+		exited:  make(chan struct{}),
+	}
+	session.contentLength = config.Framing == FramingContentLength
+	session.maxMessageBytes = config.maxMessageBytes()
+	if p, ok := process.(stderrProcess); ok && config.StderrResponses && p.Stderr() != nil {
+		session.startStderrRelay(p.Stderr())
+	}
+
+	// Reap the subprocess as soon as it exits. Its output stays readable
+	// until the pipe is drained.
+	go func() {
+		session.exitErr = process.Wait()
+		close(session.exited)
+	}()
+
+	if err := session.initialize(ctx, config, protocolVersion); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// dialSession connects to the network MCP at the endpoint of config, a
+// tcp://host:port URL, and initializes it
+func dialSession(ctx context.Context, protocolVersion string, config MCPConfig) (*mcpSession, error) {
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil || endpoint.Scheme != "tcp" || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid MCP endpoint %q, expected tcp://host:port", config.Endpoint)
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", endpoint.Host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to MCP: %w", err)
+	}
+
+	session := &mcpSession{
+		stdin:    conn,
+		stdout:   conn,
+		reader:   bufio.NewReader(conn),
+		endpoint: config.Endpoint,
+		nextID:   1,
+		exited:   make(chan struct{}),
+	}
+	session.contentLength = config.Framing == FramingContentLength
+	session.maxMessageBytes = config.maxMessageBytes()
+	if err := session.initialize(ctx, config, protocolVersion); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// initialize performs the initialize handshake, killing the session if it
+// fails. An MCP that rejects protocolVersion but names one it supports is
+// asked again with that version.
+func (s *mcpSession) initialize(ctx context.Context, config MCPConfig, protocolVersion string) error {
+	params := initializeParams(config, protocolVersion)
+	response, err := s.request(ctx, "initialize", params, nil)
+	if err != nil {
+		s.kill()
+		return err
+	}
+
+	if offered := offeredProtocolVersion(response); offered != "" && offered != params["protocolVersion"] {
+		params["protocolVersion"] = offered
+		response, err = s.request(ctx, "initialize", params, nil)
+		if err != nil {
+			s.kill()
+			return err
+		}
+	}
+
+	var initResult struct {
+		Result struct {
+			ProtocolVersion string          `json:"protocolVersion"`
+			Capabilities    json.RawMessage `json:"capabilities"`
+			ServerInfo      json.RawMessage `json:"serverInfo"`
+			Instructions    string          `json:"instructions"`
+		} `json:"result"`
+	}
+	if json.Unmarshal(response, &initResult) == nil {
+		s.protocolVersion = initResult.Result.ProtocolVersion
+		s.capabilities = initResult.Result.Capabilities
+		s.serverName, s.serverVersion = parseServerInfo(initResult.Result.ServerInfo)
+		s.instructions = initResult.Result.Instructions
+		s.supportsLogging = s.hasCapability("logging")
+	}
+
+	// Many MCPs only serve requests once told the handshake is complete
+	return s.notify("notifications/initialized", nil)
+}
+
+// parseServerInfo returns the name and version in the serverInfo of an
+// initialize result. Each is decoded on its own, so a malformed member, such
+// as a numeric version, doesn't lose the rest of the result.
+func parseServerInfo(serverInfo json.RawMessage) (string, string) {
+	var members map[string]json.RawMessage
+	if json.Unmarshal(serverInfo, &members) != nil {
+		return "", ""
+	}
+
+	var name, version string
+	json.Unmarshal(members["name"], &name)
+	if json.Unmarshal(members["version"], &version) != nil {
+		// Keep a version given as a bare number or other JSON value
+		version = string(bytes.TrimSpace(members["version"]))
+	}
+	return name, version
+}
+
+// hasCapability reports whether the MCP advertised the named capability
+func (s *mcpSession) hasCapability(name string) bool {
+	var capabilities map[string]json.RawMessage
+	if json.Unmarshal(s.capabilities, &capabilities) != nil {
+		return false
+	}
+	_, ok := capabilities[name]
+	return ok
+}
+
+// String describes where the session runs, for logging
+func (s *mcpSession) String() string {
+	if s.process == nil {
+		return s.endpoint
+	}
+	return fmt.Sprintf("pid %d", s.process.Pid())
+}
+
+// request sends a request and waits for its response, relaying progress
+// notifications to progressFn. The subprocess is killed if ctx is done first.
+func (s *mcpSession) request(ctx context.Context, method string, params interface{}, progressFn ProgressFunc) ([]byte, error) {
+	stop := s.watch(ctx)
+	defer stop()
+
+	id, written := s.send(method, params)
+	return s.await(ctx, method, id, written, progressFn)
+}
+
+// watch kills the subprocess if ctx is done before the returned function is
+// called
+func (s *mcpSession) watch(ctx context.Context) func() {
+	return killOnCancel(ctx, s.kill)
+}
+
+// send writes a request with the next id in the background, returning that
+// id and a channel that yields the outcome of the write. Writing while the
+// response is read keeps a large request and a chatty MCP from deadlocking
+// on full pipes, each side blocked writing to the other. A failed write
+// kills the session, so a read waiting on the MCP returns too.
+func (s *mcpSession) send(method string, params interface{}) (int, <-chan error) {
+	id := s.nextID
+	s.nextID++
+	written := make(chan error, 1)
+
+	data, err := s.encodeRequest(id, method, params)
+	if err != nil {
+		written <- err
+		return id, written
+	}
+
+	go func() {
+		if err := writeFull(s.stdin, data); err != nil {
+			err = fmt.Errorf("failed to send %s request: %w", method, s.withExitStatus(err))
+			s.kill()
+			written <- err
+			return
+		}
+		written <- nil
+	}()
+	return id, written
+}
+
+// notify writes a notification, which gets no response, killing the
+// session if the write fails
+func (s *mcpSession) notify(method string, params interface{}) error {
+	message := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  method,
+	}
+	if params != nil {
+		message["params"] = params
+	}
+
+	data, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s notification: %w", method, err)
+	}
+	if err := writeFull(s.stdin, frameMessage(data, s.contentLength)); err != nil {
+		err = fmt.Errorf("failed to send %s notification: %w", method, s.withExitStatus(err))
+		s.kill()
+		return err
+	}
+	return nil
+}
+
+// encodeRequest marshals and frames a request
+func (s *mcpSession) encodeRequest(id int, method string, params interface{}) ([]byte, error) {
+	message := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"method":  method,
+	}
+	if params != nil {
+		message["params"] = params
+	}
+
+	data, err := json.Marshal(message)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %s request: %w", method, err)
+	}
+	return frameMessage(data, s.contentLength), nil
+}
+
+// await reads the response to the request with the given id while send is
+// writing it, then waits for the write to finish. A failed write is reported
+// rather than the failed read it caused, unless ctx was done first.
+func (s *mcpSession) await(ctx context.Context, method string, id int, written <-chan error, progressFn ProgressFunc) ([]byte, error) {
+	response, err := s.receive(ctx, method, id, progressFn)
+	writeErr := <-written
+	if err != nil && writeErr != nil && ctx.Err() == nil {
+		return nil, writeErr
+	}
+	return response, err
+}
+
+// receive reads the response to the request with the given id
+func (s *mcpSession) receive(ctx context.Context, method string, id int, progressFn ProgressFunc) ([]byte, error) {
+	response, err := readResponse(s.readMessage, id, progressFn)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("%s request cancelled: %w", method, ctx.Err())
+		}
+		return nil, fmt.Errorf("failed to read %s response: %w", method, s.withExitStatus(err))
+	}
+	return response, nil
+}
+
+// readMessage reads the next message from the MCP in whichever framing it
+// uses
+func (s *mcpSession) readMessage() ([]byte, error) {
+	if s.relay != nil {
+		return s.relay.next()
+	}
+	return readFramedMessage(s.reader, s.maxMessageBytes)
+}
+
+// exitStatusWait is how long a failed exchange waits for the subprocess to
+// exit so its exit status can be reported
+const exitStatusWait = 500 * time.Millisecond
+
+// withExitStatus adds how the subprocess ended to err, the error of an
+// exchange that failed, if the subprocess exits shortly
+func (s *mcpSession) withExitStatus(err error) error {
+	if s.process == nil {
+		return err
+	}
+
+	select {
+	case <-s.exited:
+		return fmt.Errorf("%w: %w", s.exitErr, err)
+	case <-time.After(exitStatusWait):
+		return err
+	}
+}
+
+// closeStdin signals the MCP that no more requests will follow. A network
+// connection is only closed for writing, so the response can still be read.
+func (s *mcpSession) closeStdin() {
+	if conn, ok := s.stdin.(interface{ CloseWrite() error }); ok {
+		conn.CloseWrite()
+		return
+	}
+	s.stdin.Close()
+}
+
+// closeStdinAfter closes stdin once the write reported on written succeeds,
+// returning a channel that yields the outcome of the write in its place
+func (s *mcpSession) closeStdinAfter(written <-chan error) <-chan error {
+	closed := make(chan error, 1)
+	go func() {
+		err := <-written
+		if err == nil {
+			s.closeStdin()
+		}
+		closed <- err
+	}()
+	return closed
+}
+
+// hasExited reports whether the subprocess has exited or the connection
+// has been closed
+func (s *mcpSession) hasExited() bool {
+	select {
+	case <-s.exited:
+		return true
+	default:
+		return false
+	}
+}
+
+// kill stops the subprocess immediately and releases its output pipe, or
+// closes the connection
+func (s *mcpSession) kill() {
+	if s.process == nil {
+		s.stdout.Close()
+		s.closeOnce.Do(func() { close(s.exited) })
+		return
+	}
+	s.process.Kill()
+	s.stdout.Close()
+	if s.relay != nil {
+		s.relay.close()
+	}
+}
+
+// shutdown asks the subprocess to exit by closing its stdin, killing it if
+// it hasn't exited within grace. A connection is closed right away.
+func (s *mcpSession) shutdown(grace time.Duration) {
+	if s.process == nil {
+		s.kill()
+		return
+	}
+
+	s.closeStdin()
+	select {
+	case <-s.exited:
+		s.stdout.Close()
+		if s.relay != nil {
+			s.relay.close()
+		}
+	case <-time.After(grace):
+		s.kill()
+	}
+}
+
+// initializeParams builds the params of the initialize request sent to an
+// MCP, merging any custom params from its manifest over the standard ones
+func initializeParams(config MCPConfig, protocolVersion string) map[string]interface{} {
+	params := map[string]interface{}{
+		"protocolVersion": protocolVersion,
+	}
+	for key, value := range config.InitializeParams {
+		params[key] = value
+	}
+	return params
+}
+
+// killOnCancel calls kill, which must stop the MCP and close its output so
+// that a blocking read returns immediately, when ctx is done. The returned
+// function must be called once the caller is finished with the MCP.
+func killOnCancel(ctx context.Context, kill func()) func() {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			// Both may be ready at once; a finished exchange must not be
+			// mistaken for a cancelled one
+			select {
+			case <-done:
+				return
+			default:
+			}
+			kill()
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
+}
+
+// writeFull writes all of data to w, retrying short writes until every byte
+// is written or an error occurs
+func writeFull(w io.Writer, data []byte) error {
+	for len(data) > 0 {
+		n, err := w.Write(data)
+		data = data[n:]
+		if err != nil {
+			if errors.Is(err, syscall.EPIPE) {
+				return errSubprocessExited
+			}
+			return err
+		}
+		if n == 0 {
+			return io.ErrShortWrite
+		}
+	}
+	return nil
+}
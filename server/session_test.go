@@ -0,0 +1,311 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// handshakeThen returns a program that completes the initialize handshake
+// and then runs next
+func handshakeThen(next fakeProgram) fakeProgram {
+	return func(stdin *bufio.Reader, stdout io.Writer) *ProcessExitError {
+		for {
+			line, err := stdin.ReadBytes('\n')
+			var message rpcMessage
+			if json.Unmarshal(line, &message) == nil {
+				switch message.Method {
+				case "initialize":
+					writeReply(stdout, message, initializeReply())
+				case "notifications/initialized":
+					return next(stdin, stdout)
+				}
+			}
+			if err != nil {
+				return &ProcessExitError{ExitCode: 1}
+			}
+		}
+	}
+}
+
+func TestInitializedNotificationPrecedesRequests(t *testing.T) {
+	// A strict MCP that rejects requests until the handshake is complete
+	var methods []string
+	initialized := false
+	runner := fakeRunner{program: serveRPC(func(message rpcMessage) map[string]interface{} {
+		methods = append(methods, message.Method)
+		switch message.Method {
+		case "initialize":
+			return initializeReply()
+		case "notifications/initialized":
+			initialized = true
+			return nil
+		case "tools/list":
+			if !initialized {
+				return errorReply(-32002, "server not initialized")
+			}
+			return map[string]interface{}{
+				"result": map[string]interface{}{
+					"tools": []map[string]interface{}{{"name": "echo"}},
+				},
+			}
+		}
+		return errorReply(-32601, "method not found")
+	})}
+
+	m := NewMCPManager()
+	m.SetCommandRunner(runner)
+	discovery, err := m.getToolInfos(context.Background(), DefaultProtocolVersion, 5*time.Second, "strict-mcp", MCPConfig{})
+	if err != nil {
+		t.Fatalf("getToolInfos: %v", err)
+	}
+	if len(discovery.Tools) != 1 || discovery.Tools[0].Name != "echo" {
+		t.Fatalf("tools = %+v, want the echo tool", discovery.Tools)
+	}
+
+	want := []string{"initialize", "notifications/initialized", "tools/list"}
+	if len(methods) != len(want) {
+		t.Fatalf("methods = %v, want %v", methods, want)
+	}
+	for i := range want {
+		if methods[i] != want[i] {
+			t.Fatalf("methods = %v, want %v", methods, want)
+		}
+	}
+}
+
+func TestInitializeRenegotiation(t *testing.T) {
+	const requested = "2099-01-01"
+
+	tests := []struct {
+		name string
+		// reject is the error data of the MCP's answer to an initialize
+		// request for a version other than accepted
+		reject      map[string]interface{}
+		accepted    string
+		wantVersion string
+		wantTries   int
+	}{
+		{
+			name:        "requested version accepted",
+			accepted:    requested,
+			wantVersion: requested,
+			wantTries:   1,
+		},
+		{
+			name:        "protocolVersion offered",
+			reject:      map[string]interface{}{"protocolVersion": "2024-11-05"},
+			accepted:    "2024-11-05",
+			wantVersion: "2024-11-05",
+			wantTries:   2,
+		},
+		{
+			name:        "supported versions offered",
+			reject:      map[string]interface{}{"supported": []string{"2025-03-26", "2024-11-05"}},
+			accepted:    "2025-03-26",
+			wantVersion: "2025-03-26",
+			wantTries:   2,
+		},
+		{
+			name:        "nothing offered",
+			reject:      map[string]interface{}{},
+			accepted:    "2024-11-05",
+			wantVersion: "",
+			wantTries:   1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tries := 0
+			runner := fakeRunner{program: serveRPC(func(message rpcMessage) map[string]interface{} {
+				if message.Method != "initialize" {
+					return nil
+				}
+				tries++
+
+				var params struct {
+					ProtocolVersion string `json:"protocolVersion"`
+				}
+				json.Unmarshal(message.Params, &params)
+				if params.ProtocolVersion != tt.accepted {
+					reply := errorReply(-32602, "unsupported protocol version")
+					reply["error"].(map[string]interface{})["data"] = tt.reject
+					return reply
+				}
+				reply := initializeReply()
+				reply["result"].(map[string]interface{})["protocolVersion"] = params.ProtocolVersion
+				return reply
+			})}
+
+			session, err := startSession(context.Background(), runner, requested, "fake-mcp", MCPConfig{})
+			if err != nil {
+				t.Fatalf("startSession: %v", err)
+			}
+			session.shutdown(time.Second)
+
+			if session.protocolVersion != tt.wantVersion {
+				t.Errorf("protocolVersion = %q, want %q", session.protocolVersion, tt.wantVersion)
+			}
+			if tries != tt.wantTries {
+				t.Errorf("initialize sent %d times, want %d", tries, tt.wantTries)
+			}
+		})
+	}
+}
+
+func TestSessionRequestErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		// program runs once the handshake is complete
+		program fakeProgram
+		// cancel cancels the request's context once it is sent
+		cancel  bool
+		wantErr string
+		wantIs  error
+	}{
+		{
+			name: "exits before reading the request",
+			program: func(stdin *bufio.Reader, stdout io.Writer) *ProcessExitError {
+				return &ProcessExitError{ExitCode: 3}
+			},
+			wantErr: "failed to send tools/call request",
+			wantIs:  errSubprocessExited,
+		},
+		{
+			name: "exits without answering",
+			program: func(stdin *bufio.Reader, stdout io.Writer) *ProcessExitError {
+				stdin.ReadBytes('\n')
+				return &ProcessExitError{ExitCode: 0}
+			},
+			wantErr: "failed to read tools/call response",
+			wantIs:  io.EOF,
+		},
+		{
+			name: "answers with an oversized message",
+			program: func(stdin *bufio.Reader, stdout io.Writer) *ProcessExitError {
+				stdin.ReadBytes('\n')
+				stdout.Write([]byte(`{"jsonrpc":"2.0","id":2,"result":"` + strings.Repeat("x", DefaultMaxMCPMessageBytes) + `"}` + "\n"))
+				return &ProcessExitError{ExitCode: 0}
+			},
+			wantErr: "failed to read tools/call response",
+			wantIs:  errMCPMessageTooLarge,
+		},
+		{
+			name: "cancelled while waiting",
+			program: func(stdin *bufio.Reader, stdout io.Writer) *ProcessExitError {
+				io.Copy(io.Discard, stdin)
+				return &ProcessExitError{ExitCode: 0}
+			},
+			cancel:  true,
+			wantErr: "tools/call request cancelled",
+			wantIs:  context.Canceled,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := fakeRunner{program: handshakeThen(tt.program)}
+			session, err := startSession(context.Background(), runner, DefaultProtocolVersion, "fake-mcp", MCPConfig{})
+			if err != nil {
+				t.Fatalf("startSession: %v", err)
+			}
+			defer session.kill()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancel {
+				time.AfterFunc(50*time.Millisecond, cancel)
+			}
+
+			_, err = session.request(ctx, "tools/call", nil, nil)
+			if err == nil {
+				t.Fatal("request succeeded, want an error")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %q, want it to contain %q", err, tt.wantErr)
+			}
+			if !errors.Is(err, tt.wantIs) {
+				t.Errorf("error = %q, want it to wrap %v", err, tt.wantIs)
+			}
+		})
+	}
+}
+
+func TestSessionExitStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		exit    *ProcessExitError
+		wantErr string
+	}{
+		{
+			name:    "exit code",
+			exit:    &ProcessExitError{ExitCode: 3},
+			wantErr: "MCP subprocess exited with code 3",
+		},
+		{
+			name:    "clean exit",
+			exit:    &ProcessExitError{ExitCode: 0},
+			wantErr: "MCP subprocess exited with code 0",
+		},
+		{
+			name:    "signal",
+			exit:    &ProcessExitError{ExitCode: -1, Signal: os.Interrupt},
+			wantErr: "MCP subprocess killed by signal: interrupt",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := fakeRunner{program: handshakeThen(func(stdin *bufio.Reader, stdout io.Writer) *ProcessExitError {
+				stdin.ReadBytes('\n')
+				return tt.exit
+			})}
+			session, err := startSession(context.Background(), runner, DefaultProtocolVersion, "fake-mcp", MCPConfig{})
+			if err != nil {
+				t.Fatalf("startSession: %v", err)
+			}
+			defer session.kill()
+
+			_, err = session.request(context.Background(), "tools/call", nil, nil)
+			if !errors.Is(err, ErrMCPExited) {
+				t.Fatalf("error = %v, want ErrMCPExited", err)
+			}
+			var exitErr *ProcessExitError
+			if !errors.As(err, &exitErr) || exitErr.ExitCode != tt.exit.ExitCode || exitErr.Signal != tt.exit.Signal {
+				t.Fatalf("error = %v, want exit status %+v", err, tt.exit)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %q, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseServerInfo(t *testing.T) {
+	tests := []struct {
+		serverInfo  string
+		wantName    string
+		wantVersion string
+	}{
+		{`{"name":"weather","version":"1.2.0"}`, "weather", "1.2.0"},
+		{`{"name":"weather","version":2}`, "weather", "2"},
+		{`{"name":"weather"}`, "weather", ""},
+		{`{"name":7,"version":"1.0"}`, "", "1.0"},
+		{`"weather"`, "", ""},
+		{``, "", ""},
+	}
+
+	for _, tt := range tests {
+		name, version := parseServerInfo(json.RawMessage(tt.serverInfo))
+		if name != tt.wantName || version != tt.wantVersion {
+			t.Errorf("parseServerInfo(%s) = %q, %q, want %q, %q", tt.serverInfo, name, version, tt.wantName, tt.wantVersion)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// stderrRelay merges the JSON-RPC messages an MCP writes to stderr into
+// those it writes to stdout, for MCPs configured with stderrResponses. One
+// goroutine reads framed messages from stdout and another reads stderr line
+// by line, both handing messages to the session's reads over messages.
+type stderrRelay struct {
+	messages chan []byte
+	// err is the error that ended reading stdout, set before messages is
+	// closed
+	err error
+
+	stderr io.ReadCloser
+	// stop is closed, and stderr with it, once the session is torn down
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// startStderrRelay starts merging the JSON-RPC messages on stderr into
+// those the session reads
+func (s *mcpSession) startStderrRelay(stderr io.ReadCloser) {
+	relay := &stderrRelay{
+		messages: make(chan []byte),
+		stderr:   stderr,
+		stop:     make(chan struct{}),
+	}
+	s.relay = relay
+
+	stderrDone := make(chan struct{})
+	go func() {
+		defer close(stderrDone)
+		relay.readStderr(s.maxMessageBytes)
+	}()
+
+	go func() {
+		// A response written to stderr just before the MCP exits must not
+		// be lost to the end of stdout, so stderr is finished first
+		defer func() {
+			<-stderrDone
+			close(relay.messages)
+		}()
+
+		for {
+			message, err := readFramedMessage(s.reader, s.maxMessageBytes)
+			if len(message) > 0 {
+				select {
+				case relay.messages <- message:
+				case <-relay.stop:
+					relay.err = io.ErrClosedPipe
+					return
+				}
+			}
+			if err != nil {
+				relay.err = err
+				return
+			}
+		}
+	}()
+}
+
+// readStderr hands each line of stderr that is a JSON-RPC message over to
+// the session's reads, discarding other output
+func (r *stderrRelay) readStderr(maxMessageBytes int) {
+	reader := bufio.NewReader(r.stderr)
+	for {
+		line, err := readLine(reader, maxMessageBytes)
+		if message := bytes.TrimSpace(line); isJSONRPCMessage(message) {
+			select {
+			case r.messages <- message:
+			case <-r.stop:
+				return
+			}
+		}
+		if err != nil {
+			// Keep the MCP from blocking on a full pipe after an oversized
+			// line
+			io.Copy(io.Discard, reader)
+			return
+		}
+	}
+}
+
+// next returns the next message from stdout or stderr, or the error that
+// ended reading stdout
+func (r *stderrRelay) next() ([]byte, error) {
+	message, ok := <-r.messages
+	if !ok {
+		return nil, r.err
+	}
+	return message, nil
+}
+
+// close stops relaying, releasing both goroutines
+func (r *stderrRelay) close() {
+	r.stopOnce.Do(func() {
+		close(r.stop)
+		r.stderr.Close()
+	})
+}
+
+// isJSONRPCMessage reports whether line is a JSON object declaring itself a
+// JSON-RPC message
+func isJSONRPCMessage(line []byte) bool {
+	if len(line) == 0 || line[0] != '{' {
+		return false
+	}
+	var message struct {
+		JSONRPC string `json:"jsonrpc"`
+	}
+	return json.Unmarshal(line, &message) == nil && message.JSONRPC != ""
+}
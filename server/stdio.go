@@ -0,0 +1,230 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// stdioSession is the single client session of the stdio transport
+type stdioSession struct {
+	notifications chan mcp.JSONRPCNotification
+	initialized   bool
+	mutex         sync.Mutex
+}
+
+// SessionID implements mcpserver.ClientSession
+func (s *stdioSession) SessionID() string {
+	return "stdio"
+}
+
+// NotificationChannel implements mcpserver.ClientSession
+func (s *stdioSession) NotificationChannel() chan<- mcp.JSONRPCNotification {
+	return s.notifications
+}
+
+// Initialize implements mcpserver.ClientSession
+func (s *stdioSession) Initialize() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.initialized = true
+}
+
+// Initialized implements mcpserver.ClientSession
+func (s *stdioSession) Initialized() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.initialized
+}
+
+// stdioWriter writes newline-delimited messages, serializing responses and
+// notifications written from different goroutines
+type stdioWriter struct {
+	w     io.Writer
+	mutex sync.Mutex
+}
+
+// write writes message followed by a newline
+func (w *stdioWriter) write(message []byte) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	_, err := fmt.Fprintf(w.w, "%s\n", message)
+	return err
+}
+
+// ServeStdio serves the MCP over standard input/output
+func (s *MCPServer) ServeStdio() error {
+	return s.ServeStdioStreams(context.Background(), os.Stdin, os.Stdout)
+}
+
+// ServeStdioStreams serves newline-delimited JSON-RPC read from in, writing
+// responses and notifications to out, until in is exhausted or ctx is done.
+// Messages are handled by the underlying MCP server; JSON-RPC batches are
+// split into their elements and answered with an array.
+func (s *MCPServer) ServeStdioStreams(ctx context.Context, in io.Reader, out io.Writer) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	session := &stdioSession{notifications: make(chan mcp.JSONRPCNotification, 100)}
+	if err := s.server.RegisterSession(ctx, session); err != nil {
+		return fmt.Errorf("failed to register stdio session: %w", err)
+	}
+	defer s.server.UnregisterSession(session.SessionID())
+	ctx = s.server.WithContext(ctx, session)
+	ctx = withClientLogLevel(ctx, &clientLogLevel{})
+
+	writer := &stdioWriter{w: out}
+
+	// Relay notifications sent to the session
+	go func() {
+		for {
+			select {
+			case notification := <-session.notifications:
+				message, err := json.Marshal(notification)
+				if err == nil {
+					err = writer.write(message)
+				}
+				if err != nil {
+					s.logf("warning", "Warning: Failed to write notification: %v\n", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// Tool calls run concurrently so that messages read while they are in
+	// progress, such as cancellations, are handled. Finish them before
+	// returning.
+	var calls sync.WaitGroup
+	defer calls.Wait()
+	var writeErr error
+	var writeErrOnce sync.Once
+
+	respond := func(line []byte) {
+		response, handleErr := s.handleStdioMessage(ctx, line)
+		if handleErr != nil {
+			s.logf("warning", "Warning: Failed to handle message: %v\n", handleErr)
+		}
+		if response != nil {
+			if err := writer.write(response); err != nil {
+				writeErrOnce.Do(func() {
+					writeErr = fmt.Errorf("failed to write response: %w", err)
+					cancel()
+				})
+			}
+		}
+	}
+
+	reader := bufio.NewReader(in)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			if isToolCallRequest(line) {
+				calls.Add(1)
+				go func() {
+					defer calls.Done()
+					respond(line)
+				}()
+			} else {
+				respond(line)
+			}
+		}
+		if ctx.Err() != nil {
+			calls.Wait()
+			return writeErr
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read input: %w", err)
+		}
+	}
+}
+
+// isToolCallRequest reports whether message is a single tools/call request
+// with an id
+func isToolCallRequest(message []byte) bool {
+	var request struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+	}
+	return json.Unmarshal(message, &request) == nil && request.Method == "tools/call" && !isNotification(request.ID)
+}
+
+// handleStdioMessage handles one line of stdio input, returning the
+// response to write, if any
+func (s *MCPServer) handleStdioMessage(ctx context.Context, line []byte) ([]byte, error) {
+	var raw json.RawMessage
+	if err := json.Unmarshal(line, &raw); err != nil {
+		return newErrorResponse(nil, -32700, "Parse error")
+	}
+
+	if isBatch(raw) {
+		return processBatch(raw, func(element json.RawMessage) []byte {
+			response, err := s.handleMessage(ctx, element)
+			if err != nil {
+				s.logf("warning", "Warning: Failed to handle message: %v\n", err)
+			}
+			return response
+		})
+	}
+
+	return s.handleMessage(ctx, raw)
+}
+
+// handleMessage passes a single message to the underlying MCP server, which
+// doesn't implement logging/setLevel or cancellation, so those are handled
+// here
+func (s *MCPServer) handleMessage(ctx context.Context, message json.RawMessage) ([]byte, error) {
+	var request struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+	}
+	if json.Unmarshal(message, &request) == nil {
+		switch {
+		case request.Method == "logging/setLevel" && !isNotification(request.ID):
+			return s.handleSetLevel(ctx, request.ID, message)
+		case request.Method == "notifications/cancelled" && isNotification(request.ID):
+			s.handleCancelled(message)
+			return nil, nil
+		case request.Method == "tools/call" && !isNotification(request.ID):
+			var done func()
+			ctx, done = s.trackRequest(ctx, request.ID)
+			defer done()
+		}
+	}
+
+	response := s.server.HandleMessage(ctx, message)
+	if response == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(response)
+	if err != nil || isNotification(request.ID) {
+		return data, err
+	}
+	return withRequestID(data, request.ID)
+}
+
+// withRequestID replaces the id of response with id, the raw id of the
+// request. The underlying MCP server decodes ids as float64, which would
+// otherwise echo large integer ids inexactly.
+func withRequestID(response []byte, id json.RawMessage) ([]byte, error) {
+	var message map[string]json.RawMessage
+	if err := json.Unmarshal(response, &message); err != nil {
+		return nil, err
+	}
+	if _, ok := message["id"]; !ok {
+		return response, nil
+	}
+	message["id"] = id
+	return marshalResponse(message)
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// NotifyFunc receives JSON-RPC messages, such as progress notifications, that
+// are sent to the client while a request is still being processed
+type NotifyFunc func(message []byte)
+
+// eventStream lazily upgrades an HTTP response to a text/event-stream the
+// first time a message is sent, so requests that produce no notifications
+// are still answered with a plain JSON body
+type eventStream struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	started bool
+	mutex   sync.Mutex
+}
+
+// newEventStream returns an event stream for w, or nil if w can't be flushed
+func newEventStream(w http.ResponseWriter) *eventStream {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil
+	}
+	return &eventStream{w: w, flusher: flusher}
+}
+
+// send writes message as an SSE message event, starting the stream if needed
+func (e *eventStream) send(message []byte) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if !e.started {
+		e.w.Header().Set("Content-Type", "text/event-stream")
+		e.w.Header().Set("Cache-Control", "no-cache")
+		e.w.WriteHeader(http.StatusOK)
+		e.started = true
+	}
+
+	fmt.Fprintf(e.w, "event: message\ndata: %s\n\n", message)
+	e.flusher.Flush()
+}
+
+// isStarted reports whether the response has been upgraded to a stream
+func (e *eventStream) isStarted() bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.started
+}
+
+// acceptsEventStream reports whether the request's Accept header allows a
+// text/event-stream response
+func acceptsEventStream(r *http.Request) bool {
+	for _, value := range r.Header.Values("Accept") {
+		for _, part := range strings.Split(value, ",") {
+			mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err == nil && mediaType == "text/event-stream" {
+				return true
+			}
+		}
+	}
+	return false
+}
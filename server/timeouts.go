@@ -0,0 +1,38 @@
+package server
+
+import "time"
+
+// DefaultDiscoveryTimeout bounds the initialize handshake and tools/list
+// query that discover an MCP's tools, unless configured otherwise
+const DefaultDiscoveryTimeout = DefaultRequestTimeout
+
+// SetTimeouts sets how long discovering an MCP's tools may take and the
+// default limit of tool calls, with zero for no limit. A tool's own
+// timeoutSeconds overrides the default for its calls.
+func (m *MCPManager) SetTimeouts(discovery, exec time.Duration) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.discoveryTimeout = discovery
+	m.execTimeout = exec
+}
+
+// currentDiscoveryTimeout returns how long discovering an MCP's tools may
+// take, or zero for no limit
+func (m *MCPManager) currentDiscoveryTimeout() time.Duration {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.discoveryTimeout
+}
+
+// callTimeout returns how long a call of the tool named localToolName may
+// take, or zero for no limit: the tool's own timeout if it has one, else
+// the default for tool calls
+func (m *MCPManager) callTimeout(mcpInfo *MCPInfo, localToolName string) time.Duration {
+	if tool, ok := mcpInfo.Config.Tools[localToolName]; ok && tool.TimeoutSeconds > 0 {
+		return time.Duration(tool.TimeoutSeconds) * time.Second
+	}
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.execTimeout
+}
@@ -0,0 +1,20 @@
+package server
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer creates the server's spans. Until a tracer provider is installed,
+// for example with telemetry.Setup, spans are not recorded.
+var tracer = otel.Tracer("github.com/mcp-net/mcp-proxy/server")
+
+// endSpan ends span, marking it failed if err is set
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
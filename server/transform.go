@@ -0,0 +1,43 @@
+package server
+
+// ArgTransformer reshapes the arguments of a tool call before they are sent
+// to an MCP, for MCPs that expect them in a different form than clients
+// send, e.g. snake_case keys or a nested wrapper object. It is given a copy
+// of the arguments and returns the arguments to send.
+type ArgTransformer func(arguments map[string]interface{}) map[string]interface{}
+
+// SetArgTransformer registers transformer for the arguments of calls to the
+// tools of the MCP named mcpName, replacing any registered before. A nil
+// transformer removes it.
+func (m *MCPManager) SetArgTransformer(mcpName string, transformer ArgTransformer) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if transformer == nil {
+		delete(m.argTransformers, mcpName)
+		return
+	}
+	if m.argTransformers == nil {
+		m.argTransformers = make(map[string]ArgTransformer)
+	}
+	m.argTransformers[mcpName] = transformer
+}
+
+// transformArguments returns the arguments to send to the MCP named mcpName,
+// as reshaped by its transformer if one is registered. The caller's map is
+// left untouched.
+func (m *MCPManager) transformArguments(mcpName string, parameters map[string]interface{}) map[string]interface{} {
+	m.mutex.RLock()
+	transformer := m.argTransformers[mcpName]
+	m.mutex.RUnlock()
+
+	if transformer == nil {
+		return parameters
+	}
+
+	arguments := make(map[string]interface{}, len(parameters))
+	for key, value := range parameters {
+		arguments[key] = value
+	}
+	return transformer(arguments)
+}
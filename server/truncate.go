@@ -0,0 +1,52 @@
+package server
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// truncateResult returns result with the text of its text content blocks
+// cut so that together they hold at most maxBytes bytes, each cut block
+// ending in a marker saying how many bytes were cut. Other content, such
+// as images, resources and structured content, is left intact. result
+// itself is not modified, since it may be shared with other callers. A
+// limit of zero or less disables truncation.
+func truncateResult(result *CallToolResult, maxBytes int) *CallToolResult {
+	if result == nil || maxBytes <= 0 {
+		return result
+	}
+
+	total := 0
+	for _, content := range result.Content {
+		if content.Type == "text" {
+			total += len(content.Text)
+		}
+	}
+	if total <= maxBytes {
+		return result
+	}
+
+	truncated := *result
+	truncated.Content = make([]Content, len(result.Content))
+	remaining := maxBytes
+	for i, content := range result.Content {
+		if content.Type == "text" {
+			if len(content.Text) > remaining {
+				content.Text = truncateText(content.Text, remaining)
+			}
+			remaining -= min(len(content.Text), remaining)
+		}
+		truncated.Content[i] = content
+	}
+	return &truncated
+}
+
+// truncateText cuts text to at most maxBytes bytes, without splitting a
+// UTF-8 sequence, and appends a marker saying how many bytes were cut
+func truncateText(text string, maxBytes int) string {
+	cut := maxBytes
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return fmt.Sprintf("%s...[truncated %d bytes]", text[:cut], len(text)-cut)
+}
@@ -0,0 +1,58 @@
+package server
+
+import "sort"
+
+// ValidationReport describes the outcome of loading the MCP directory,
+// for checking a tool catalog without serving it
+type ValidationReport struct {
+	Valid      bool        `json:"valid"`
+	MCPs       []MCPReport `json:"mcps"`
+	LoadErrors []LoadError `json:"loadErrors"`
+}
+
+// MCPReport lists the tools an MCP advertised when it was loaded
+type MCPReport struct {
+	Name   string   `json:"name"`
+	Path   string   `json:"path"`
+	Status string   `json:"status"`
+	Tools  []string `json:"tools"`
+}
+
+// Validate reports the MCPs loaded and their tools, and every MCP that
+// failed to load. The report is valid if there were no load errors.
+func (s *MCPServer) Validate() ValidationReport {
+	m := s.mcpManager
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	report := ValidationReport{
+		MCPs:       make([]MCPReport, 0, len(m.mcpMap)),
+		LoadErrors: make([]LoadError, len(m.loadErrors)),
+	}
+	copy(report.LoadErrors, m.loadErrors)
+	report.Valid = len(report.LoadErrors) == 0
+
+	for _, mcpInfo := range m.mcpMap {
+		tools := make([]string, 0, len(mcpInfo.ToolInfos))
+		for _, tool := range mcpInfo.ToolInfos {
+			tools = append(tools, tool.Name)
+		}
+		sort.Strings(tools)
+		report.MCPs = append(report.MCPs, MCPReport{
+			Name:   mcpInfo.Name,
+			Path:   mcpInfo.Path,
+			Status: mcpInfo.Status,
+			Tools:  tools,
+		})
+	}
+	sort.Slice(report.MCPs, func(i, j int) bool {
+		return report.MCPs[i].Name < report.MCPs[j].Name
+	})
+	return report
+}
+
+// Tools returns the tools served from the loaded MCPs, sorted by name,
+// with the names clients call them by
+func (s *MCPServer) Tools() []ToolInfo {
+	return s.mcpManager.GetAllTools()
+}